@@ -0,0 +1,193 @@
+// Authentication of the requests to Mesos by pluggable providers: HTTP basic
+// authentication, DC/OS strict mode logins, static bearer tokens read from a
+// file, and OAuth2 client credentials against an arbitrary token URL. At most
+// one provider is used, chosen by the configuration. Secrets can be read from
+// files, e.g. mounted Mesos or Kubernetes secrets, and are never logged.
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authProvider authenticates the requests of the clients.
+type authProvider interface {
+	// authenticate adds the credentials to a request, failing if there are
+	// none to add.
+	authenticate(req *http.Request) error
+}
+
+// basicAuth authenticates requests with HTTP basic authentication.
+type basicAuth struct {
+	username string
+	password func() string
+}
+
+func (a *basicAuth) authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password())
+	return nil
+}
+
+// bearerTokenFile authenticates requests with a static bearer token read from
+// a file, which is reloaded when it changes.
+type bearerTokenFile struct {
+	token func() string
+}
+
+func newBearerTokenFile(path string) (*bearerTokenFile, error) {
+	token, err := secretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &bearerTokenFile{token}, nil
+}
+
+func (a *bearerTokenFile) authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.token())
+	return nil
+}
+
+// secretFile returns a function returning the content of a secret file
+// without surrounding whitespace, which is read again when it changes.
+func secretFile(path string) (func() string, error) {
+	file, err := newWatchedFiles([]string{path}, func(contents [][]byte) (interface{}, error) {
+		secret := strings.TrimSpace(string(contents[0]))
+		if secret == "" {
+			return nil, errors.New("empty secret file " + path)
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() string { return file.get().(string) }, nil
+}
+
+// secretValue returns the function returning a secret given by a file, value,
+// or the environment variable env, in order of precedence.
+func secretValue(value secret, env, file string) (func() string, error) {
+	if file != "" {
+		return secretFile(file)
+	}
+	if value == "" {
+		value = secret(os.Getenv(env))
+		log.WithField("variable", env).Debug("no secret given, pulling from the environment")
+	}
+	return func() string { return string(value) }, nil
+}
+
+// oauth2Token is the response of an OAuth2 token endpoint.
+type oauth2Token struct {
+	AccessToken string  `json:"access_token"`
+	TokenType   string  `json:"token_type"`
+	ExpiresIn   float64 `json:"expires_in"`
+}
+
+// oauth2Login returns a login obtaining tokens from an OAuth2 token endpoint
+// with the client credentials grant.
+func oauth2Login(client *http.Client, tokenURL, clientID string, clientSecret func() string, scopes []string) func() (string, time.Time, error) {
+	return func() (string, time.Time, error) {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if len(scopes) > 0 {
+			form.Set("scope", strings.Join(scopes, " "))
+		}
+		req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", time.Time{}, &loginError{"request", err}
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret()))
+
+		now := time.Now()
+		var token oauth2Token
+		if err := doLogin(client, req, &token); err != nil {
+			return "", time.Time{}, err
+		}
+		if token.AccessToken == "" {
+			return "", time.Time{}, &loginError{"response", errors.New("no access token in response")}
+		}
+		if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+			return "", time.Time{}, &loginError{"response", errors.New("unsupported token type " + token.TokenType)}
+		}
+
+		expiry, ok := now.Add(time.Duration(token.ExpiresIn*float64(time.Second))), token.ExpiresIn > 0
+		if !ok {
+			if expiry, ok = tokenExpiry(token.AccessToken); !ok {
+				expiry = now.Add(loginTokenLifetime)
+			}
+		}
+		return token.AccessToken, expiry, nil
+	}
+}
+
+// authProvider returns the authentication provider of the configuration, or
+// nil if requests are not authenticated. Logins use the TLS configuration of
+// the clients.
+func (cfg *config) authProvider(tlsConfig *tls.Config) (authProvider, error) {
+	login := &http.Client{Timeout: cfg.Timeout, Transport: newClientTransport(tlsConfig, cfg.Timeout)}
+
+	switch {
+	case cfg.Auth.StrictMode:
+		uid, loginURL := cfg.Auth.Username, cfg.Auth.LoginURL
+		if uid == "" {
+			uid = os.Getenv("MESOS_EXPORTER_USERNAME")
+			log.WithField("username", uid).Debug("auth with no username, pulling from the environment")
+		}
+		var signingKey func() []byte
+		var secret *mesosSecret
+		if cfg.Auth.PrivateKeyFile != "" {
+			key, err := newWatchedFiles([]string{cfg.Auth.PrivateKeyFile}, parseSigningKey)
+			if err != nil {
+				return nil, fmt.Errorf("error loading private key: %v", err)
+			}
+			signingKey, secret = privateKeyFunc(key), key.get().(*mesosSecret)
+		} else {
+			privateKey := string(cfg.Auth.PrivateKey)
+			if privateKey == "" {
+				privateKey = os.Getenv("MESOS_EXPORTER_PRIVATE_KEY")
+				log.Debug("strict mode, no private key, pulling from the environment")
+			}
+			signingKey, secret = parsePrivateKey(privateKey)
+		}
+		if secret != nil && secret.UID != "" {
+			uid = secret.UID
+		}
+		if secret != nil && secret.LoginEndpoint != "" {
+			loginURL = secret.LoginEndpoint
+		}
+		return newTokenManager(loginURL, "token=%s", strictLogin(login, loginURL, uid, signingKey)), nil
+
+	case cfg.Auth.BearerTokenFile != "":
+		return newBearerTokenFile(cfg.Auth.BearerTokenFile)
+
+	case cfg.Auth.OAuth2.TokenURL != "":
+		o := cfg.Auth.OAuth2
+		clientSecret, err := secretValue(o.ClientSecret, "MESOS_EXPORTER_OAUTH2_CLIENT_SECRET", o.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading OAuth2 client secret: %v", err)
+		}
+		return newTokenManager(o.TokenURL, "Bearer %s", oauth2Login(login, o.TokenURL, o.ClientID, clientSecret, o.Scopes)), nil
+	}
+
+	username := cfg.Auth.Username
+	if username == "" {
+		username = os.Getenv("MESOS_EXPORTER_USERNAME")
+		log.WithField("username", username).Debug("auth with no username, pulling from the environment")
+	}
+	password, err := secretValue(cfg.Auth.Password, "MESOS_EXPORTER_PASSWORD", cfg.Auth.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading password: %v", err)
+	}
+	if username != "" && password() != "" {
+		return &basicAuth{username, password}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBearerTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	write := func(token string) {
+		if err := ioutil.WriteFile(file, []byte(token), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first\n")
+	auth, err := newBearerTokenFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ content, want string }{
+		{"first\n", "Bearer first"},
+		{"second", "Bearer second"},
+		// An emptied file keeps the previous token.
+		{"", "Bearer second"},
+	} {
+		write(c.content)
+		req, _ := http.NewRequest("GET", "http://localhost:5050", nil)
+		if err := auth.authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != c.want {
+			t.Errorf("file %q: got Authorization %q, want %q", c.content, got, c.want)
+		}
+	}
+
+	write("")
+	if _, err := newBearerTokenFile(file); err == nil {
+		t.Error("expected error loading an empty token file")
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+	var logins int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		// The credentials are form encoded, as required by RFC 6749.
+		id, secret, _ := r.BasicAuth()
+		secret, _ = url.QueryUnescape(secret)
+		if r.FormValue("grant_type") != "client_credentials" || id != "exporter" || secret != "s&cret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		if scope := r.FormValue("scope"); scope != "mesos metrics" {
+			http.Error(w, "invalid scope "+scope, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&oauth2Token{AccessToken: "access", TokenType: "bearer", ExpiresIn: 3600})
+	}))
+	defer idp.Close()
+
+	var authorization atomic.Value
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Write([]byte("{}"))
+	}))
+	defer target.Close()
+
+	cfg := &config{}
+	cfg.Auth.OAuth2.TokenURL = idp.URL
+	cfg.Auth.OAuth2.ClientID = "exporter"
+	cfg.Auth.OAuth2.ClientSecret = "s&cret"
+	cfg.Auth.OAuth2.Scopes = []string{"mesos", "metrics"}
+	auth, err := cfg.authProvider(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &httpClient{url: target.URL, auth: auth}
+	var v map[string]interface{}
+	for i := 0; i < 2; i++ {
+		if !client.fetchAndDecode("/metrics/snapshot", &v) {
+			t.Fatal("request failed")
+		}
+	}
+	if got, _ := authorization.Load().(string); got != "Bearer access" {
+		t.Errorf("got Authorization %q, want %q", got, "Bearer access")
+	}
+	if logins != 1 {
+		t.Errorf("got %d logins, want 1", logins)
+	}
+
+	cfg.Auth.OAuth2.ClientSecret = "wrong"
+	if auth, err = cfg.authProvider(nil); err != nil {
+		t.Fatal(err)
+	}
+	client.auth = auth
+	if client.fetchAndDecode("/metrics/snapshot", &v) {
+		t.Error("request succeeded without a token")
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var logs bytes.Buffer
+	defer log.SetOutput(log.StandardLogger().Out)
+	defer log.SetLevel(log.GetLevel())
+	log.SetOutput(&logs)
+	log.SetLevel(log.DebugLevel)
+
+	// A password file is read again when it changes.
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("file-secret-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config{}
+	cfg.Auth.Username = "exporter"
+	cfg.Auth.PasswordFile = passwordFile
+	auth, err := cfg.authProvider(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"file-secret-1", "file-secret-2"} {
+		if err := ioutil.WriteFile(passwordFile, []byte(want), 0600); err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", "http://localhost:5050", nil)
+		auth.authenticate(req)
+		if _, password, _ := req.BasicAuth(); password != want {
+			t.Errorf("got password %q, want %q", password, want)
+		}
+	}
+
+	// A secret in JSON gives the service account and login URL.
+	iam, key := newFakeIAM(t, time.Now)
+	login := httptest.NewServer(iam)
+	defer login.Close()
+	secretJSON, _ := json.Marshal(&mesosSecret{UID: "exporter", LoginEndpoint: login.URL, PrivateKey: string(key)})
+	keyFile := filepath.Join(dir, "key.json")
+	if err := ioutil.WriteFile(keyFile, secretJSON, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg = &config{}
+	cfg.Auth.StrictMode = true
+	cfg.Auth.PrivateKeyFile = keyFile
+	if auth, err = cfg.authProvider(nil); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://localhost:5050", nil)
+	if err := auth.authenticate(req); err != nil {
+		t.Errorf("error logging in with secret file: %v", err)
+	}
+
+	// Secrets from the environment and invalid keys are not logged.
+	os.Setenv("MESOS_EXPORTER_PASSWORD", "env-secret")
+	defer os.Unsetenv("MESOS_EXPORTER_PASSWORD")
+	cfg = &config{}
+	cfg.Auth.Username = "exporter"
+	if _, err := cfg.authProvider(nil); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Auth.StrictMode = true
+	cfg.Auth.PrivateKey = `{"uid": "exporter", "private_key": "key-secret"`
+	if _, err := cfg.authProvider(nil); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Auth.OAuth2.ClientSecret = "oauth2-secret"
+
+	// Nor are secrets of printed or marshaled configurations.
+	out, err := yaml.Marshal(cfg.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(&logs, "%v %+v %#v %s", cfg, cfg, cfg, out)
+	for _, secret := range []string{"file-secret", "env-secret", "key-secret", "oauth2-secret"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("%s in output:\n%s", secret, logs.String())
+		}
+	}
+	if !strings.Contains(string(out), "<secret>") {
+		t.Errorf("got marshaled configuration %s, want redacted secrets", out)
+	}
+}
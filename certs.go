@@ -0,0 +1,277 @@
+// Reloading of the client certificates, trusted CA bundles and strict mode
+// private keys used to query Mesos, so that rotated files are picked up
+// without restarting the exporter. The files are read again whenever they are
+// used, and parsed again when their content changed. A file that cannot be
+// parsed, e.g. a certificate whose key has not been rotated yet, is retried
+// the next time, using the previous content meanwhile.
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchedFiles are files parsed together into a value, which is parsed again
+// when their content changes.
+type watchedFiles struct {
+	paths []string
+	parse func(contents [][]byte) (interface{}, error)
+
+	mu       sync.Mutex
+	contents [][]byte
+	value    interface{}
+}
+
+// newWatchedFiles reads and parses the files, failing if they cannot be.
+func newWatchedFiles(paths []string, parse func([][]byte) (interface{}, error)) (*watchedFiles, error) {
+	f := &watchedFiles{paths: paths, parse: parse}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *watchedFiles) load() error {
+	contents := make([][]byte, len(f.paths))
+	changed := f.contents == nil
+	for i, path := range f.paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[i] = content
+		changed = changed || !bytes.Equal(content, f.contents[i])
+	}
+	if !changed {
+		return nil
+	}
+
+	value, err := f.parse(contents)
+	if err != nil {
+		return err
+	}
+	if f.contents != nil {
+		log.WithField("files", f.paths).Info("Reloaded changed files")
+	}
+	f.contents, f.value = contents, value
+	return nil
+}
+
+// get returns the value of the current content of the files, or of the
+// previous content if the current one cannot be parsed.
+func (f *watchedFiles) get() interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(); err != nil {
+		log.WithFields(log.Fields{
+			"files": f.paths,
+			"error": err,
+		}).Error("Error reloading files, using the previous content")
+		errorCounter.Inc()
+	}
+	return f.value
+}
+
+// certificateExpiry exports the expiry of the certificates in the files
+// loaded by the exporter.
+var certificateExpiry = &certificateCollector{
+	desc: prometheus.NewDesc(
+		"mesos_exporter_certificate_expiry_timestamp_seconds",
+		"Expiry of the certificates in the client certificate and trusted CA files.",
+		[]string{"file", "subject", "serial"},
+		nil,
+	),
+	files: map[string][]*x509.Certificate{},
+}
+
+type certificateCollector struct {
+	desc *prometheus.Desc
+
+	mu    sync.Mutex
+	files map[string][]*x509.Certificate
+}
+
+func (c *certificateCollector) set(file string, certs []*x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[file] = certs
+}
+
+// reset forgets the certificates of the files loaded so far, e.g. before the
+// files of a new configuration are loaded, and returns them for restore.
+func (c *certificateCollector) reset() map[string][]*x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := c.files
+	c.files = map[string][]*x509.Certificate{}
+	return files
+}
+
+// restore replaces the certificates by those returned by reset, e.g. when the
+// new configuration is not applied.
+func (c *certificateCollector) restore(files map[string][]*x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files = files
+}
+
+func (c *certificateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *certificateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for file, certs := range c.files {
+		for _, cert := range certs {
+			ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(cert.NotAfter.Unix()),
+				file, cert.Subject.CommonName, cert.SerialNumber.String())
+		}
+	}
+}
+
+// parseCertificates parses the PEM encoded certificates of a file.
+func parseCertificates(file string, content []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate in %s: %v", file, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates in .pem file %s", file)
+	}
+	return certs, nil
+}
+
+// newClientTLSConfig returns the TLS configuration of the clients querying
+// Mesos, which reloads the trusted CAs and the client certificate when their
+// files change.
+func newClientTLSConfig(trustedCerts []string, certFile, keyFile string, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: skipVerify}
+
+	if len(trustedCerts) > 0 && !skipVerify {
+		roots, err := newWatchedFiles(trustedCerts, func(contents [][]byte) (interface{}, error) {
+			pool := x509.NewCertPool()
+			files := make([][]*x509.Certificate, len(contents))
+			for i, content := range contents {
+				certs, err := parseCertificates(trustedCerts[i], content)
+				if err != nil {
+					return nil, err
+				}
+				for _, cert := range certs {
+					pool.AddCert(cert)
+				}
+				files[i] = certs
+			}
+			// The expiry is only exported once all files are trusted.
+			for i, certs := range files {
+				certificateExpiry.set(trustedCerts[i], certs)
+			}
+			return pool, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("x509 certificate pool error: %v", err)
+		}
+
+		// The server certificate chain is verified against the current roots
+		// instead of a fixed pool. Its name is verified by newClientTransport.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no server certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots.get().(*x509.CertPool),
+				Intermediates: x509.NewCertPool(),
+			}
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return fmt.Errorf("error parsing server certificate: %v", err)
+				}
+				certs[i] = cert
+				if i > 0 {
+					opts.Intermediates.AddCert(cert)
+				}
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+
+	if certFile != "" && keyFile != "" {
+		pair, err := newWatchedFiles([]string{certFile, keyFile}, func(contents [][]byte) (interface{}, error) {
+			cert, err := tls.X509KeyPair(contents[0], contents[1])
+			if err != nil {
+				return nil, err
+			}
+			certs, err := parseCertificates(certFile, contents[0])
+			if err != nil {
+				return nil, err
+			}
+			certificateExpiry.set(certFile, certs[:1])
+			return &cert, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS client certificates: %v", err)
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.get().(*tls.Certificate), nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+// newClientTransport returns the transport of the clients querying Mesos with
+// the TLS configuration. VerifyPeerCertificate is not given the name of the
+// server, so with reloaded trusted CAs the server certificate is also verified
+// for the dialed host during the handshake of each connection.
+func newClientTransport(tlsConfig *tls.Config, timeout time.Duration) *http.Transport {
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	if tlsConfig == nil || tlsConfig.VerifyPeerCertificate == nil {
+		return transport
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	transport.DialTLS = func(network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := tlsConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+		verifyChain := tlsConfig.VerifyPeerCertificate
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+			if err := verifyChain(rawCerts, chains); err != nil {
+				return err
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			return cert.VerifyHostname(cfg.ServerName)
+		}
+		return tls.DialWithDialer(dialer, network, addr, cfg)
+	}
+	return transport
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestClientTLSConfigReload(t *testing.T) {
+	serverDir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(serverDir)
+	clientDir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(clientDir)
+
+	// The server trusts and presents the current certificates in the files.
+	serverCert, serverKey := writeCert(t, serverDir, 1)
+	clientCert, clientKey := writeCert(t, clientDir, 10)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].SerialNumber.String()))
+	}))
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+			return &tls.Config{Certificates: []tls.Certificate{cert}, ClientAuth: tls.RequireAnyClientCert}, err
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	trusted := filepath.Join(clientDir, "ca.pem")
+	trust := func() {
+		content, err := ioutil.ReadFile(serverCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(trusted, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trust()
+
+	tlsConfig, err := newClientTLSConfig([]string{trusted}, clientCert, clientKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := newClientTransport(tlsConfig, time.Second)
+	transport.DisableKeepAlives = true
+	client := &http.Client{Transport: transport}
+	get := func() (string, error) {
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	if serial, err := get(); err != nil || serial != "10" {
+		t.Fatalf("got client certificate %q, error %v, want 10", serial, err)
+	}
+
+	// The certificate is only valid for the server's IP address.
+	if _, err := client.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)); err == nil {
+		t.Error("expected error for a host not in the server certificate")
+	}
+
+	// A rotated server certificate is only trusted once the CA file is.
+	writeCert(t, serverDir, 2)
+	if _, err := get(); err == nil {
+		t.Error("expected error before the rotated certificate is trusted")
+	}
+	trust()
+	writeCert(t, clientDir, 11)
+	if serial, err := get(); err != nil || serial != "11" {
+		t.Errorf("got client certificate %q, error %v after rotation, want 11", serial, err)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	certificateExpiry.Collect(ch)
+	close(ch)
+	serials := map[string]bool{}
+	for m := range ch {
+		var metric dto.Metric
+		m.Write(&metric)
+		for _, l := range metric.GetLabel() {
+			if l.GetName() == "serial" {
+				serials[l.GetValue()] = true
+			}
+		}
+	}
+	if !serials["2"] || !serials["11"] {
+		t.Errorf("got certificate expiry of serials %v, want 2 and 11", serials)
+	}
+
+	// The files of a new configuration replace those of the previous one.
+	previous := certificateExpiry.reset()
+	if len(previous) != 2 || len(certificateExpiry.files) != 0 {
+		t.Errorf("got %d files before and %d after reset, want 2 and 0", len(previous), len(certificateExpiry.files))
+	}
+	certificateExpiry.restore(previous)
+}
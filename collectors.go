@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectorFactory creates a named collector of a master or an agent.
+type collectorFactory struct {
+	// master tells whether the collector runs against a master or an agent.
+	master bool
+	// enabled tells whether the collector is enabled by default.
+	enabled bool
+	help    string
+	// new creates the collector. client is configured to use the v1
+	// Operator API if it was selected for the collector. Background work
+	// must stop when ctx is done.
+	new func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector
+}
+
+// collectorFactories are the collectors of the exporter by name.
+var collectorFactories = map[string]collectorFactory{
+	"master_snapshot": {
+		master:  true,
+		enabled: true,
+		help:    "metrics from the master's /metrics/snapshot endpoint",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			return newMasterCollector(client)
+		},
+	},
+	"master_state": {
+		master:  true,
+		enabled: true,
+		help:    "agent resources and attributes from the master's state",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			attributes, _ := cfg.slaveAttributeSelector()
+			if !cfg.MasterEvents {
+				return newMasterStateCollector(client, cfg.MasterStateEndpoint, attributes, cfg.ExplodedSlaveAttributes)
+			}
+			// The event stream is only available from the Operator API.
+			stream := *client
+			stream.operatorAPI, _ = cfg.operatorContentType()
+			subscriber := newMasterSubscriber(&stream, cfg.TaskTransitionsDropLabels)
+			go subscriber.run(ctx)
+			return newMasterEventStateCollector(client, cfg.MasterStateEndpoint, attributes, cfg.ExplodedSlaveAttributes, subscriber)
+		},
+	},
+	"master_roles": {
+		master:  true,
+		enabled: false,
+		help:    "role weights, resources and quota from the master's /roles and /quota endpoints",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			return newMasterRolesCollector(client)
+		},
+	},
+	"master_maintenance": {
+		master: true,
+		help:   "machine maintenance and agent drain state from the master",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			return newMasterMaintenanceCollector(client)
+		},
+	},
+	"agent_snapshot": {
+		enabled: true,
+		help:    "metrics from the agent's /metrics/snapshot endpoint",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			return newSlaveCollector(client)
+		},
+	},
+	"agent_monitor": {
+		enabled: true,
+		help:    "container statistics from the agent's /monitor/statistics endpoint",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			return newSlaveMonitorCollector(client)
+		},
+	},
+	"agent_state": {
+		enabled: true,
+		help:    "resources, frameworks, executors and tasks from the agent's /slave(1)/state endpoint",
+		new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			taskLabels, _ := cfg.taskLabelSelector()
+			attributes, _ := cfg.slaveAttributeSelector()
+			return newSlaveStateCollector(client, taskLabels, attributes, cfg.ExplodedSlaveAttributes)
+		},
+	},
+}
+
+// collectorNames returns the sorted names of all collectors.
+func collectorNames() []string {
+	var names []string
+	for name := range collectorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultCollectors returns whether each collector is enabled by default.
+func defaultCollectors() map[string]bool {
+	collectors := map[string]bool{}
+	for name, f := range collectorFactories {
+		collectors[name] = f.enabled
+	}
+	return collectors
+}
+
+// collectorFlag is a boolean flag enabling or disabling a collector in
+// collectors. It is set to enable if given.
+type collectorFlag struct {
+	collectors map[string]bool
+	name       string
+	enable     bool
+}
+
+func (f *collectorFlag) IsBoolFlag() bool { return true }
+
+// String returns whether the collector is enabled for the positive flag. The
+// negative flag is false, so that its default is not shown in the usage.
+func (f *collectorFlag) String() string {
+	return strconv.FormatBool(f.enable && f.collectors[f.name])
+}
+
+func (f *collectorFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	f.collectors[f.name] = v == f.enable
+	return nil
+}
+
+// registerCollectorFlags adds the -collector.<name> and -no-collector.<name>
+// flags of all collectors to fs, which set whether they are enabled in
+// collectors.
+func registerCollectorFlags(fs *flag.FlagSet, collectors map[string]bool) {
+	for _, name := range collectorNames() {
+		f := collectorFactories[name]
+		fs.Var(&collectorFlag{collectors, name, true}, "collector."+name,
+			fmt.Sprintf("Enable the %s collector: %s", name, f.help))
+		fs.Var(&collectorFlag{collectors, name, false}, "no-collector."+name,
+			fmt.Sprintf("Disable the %s collector", name))
+	}
+}
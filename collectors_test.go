@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectorFlags(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want map[string]bool
+	}{
+		{nil, nil},
+		{[]string{"-collector.master_maintenance"}, map[string]bool{"master_maintenance": true}},
+		{[]string{"--no-collector.agent_monitor", "-collector.master_state=false"}, map[string]bool{"agent_monitor": false, "master_state": false}},
+		{[]string{"-no-collector.master_roles", "-collector.master_roles"}, map[string]bool{"master_roles": true}},
+	} {
+		collectors := defaultCollectors()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		registerCollectorFlags(fs, collectors)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+
+		want := defaultCollectors()
+		for name, enabled := range tt.want {
+			want[name] = enabled
+		}
+		if !reflect.DeepEqual(collectors, want) {
+			t.Errorf("%v: got %v, want %v", tt.args, collectors, want)
+		}
+	}
+}
+
+func TestExporterGatherer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := &config{
+		Slave:      targets{srv.URL},
+		Timeout:    time.Second,
+		Collectors: map[string]bool{"agent_snapshot": true, "agent_state": true},
+	}
+	e := newExporter(func() (*config, error) { return cfg, cfg.validate() })
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(e.collectors), 2; got != want {
+		t.Errorf("got %d collectors, want %d", got, want)
+	}
+
+	if _, err := e.gatherer(nil); err != nil {
+		t.Errorf("unexpected error selecting all collectors: %v", err)
+	}
+	if _, err := e.gatherer([]string{"agent_state", "agent_state"}); err != nil {
+		t.Errorf("unexpected error selecting agent_state: %v", err)
+	}
+	for _, names := range [][]string{{"agent_monitor"}, {"master_state"}, {"foo"}} {
+		if _, err := e.gatherer(names); err == nil {
+			t.Errorf("expected error selecting disabled collectors %v", names)
+		}
+	}
+}
+
+func TestExporterTargets(t *testing.T) {
+	var servers []string
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"master/uptime_secs": 10, "slave/uptime_secs": 10}`))
+		}))
+		defer srv.Close()
+		servers = append(servers, srv.URL)
+	}
+
+	cfg := &config{
+		Master:     targets{servers[0]},
+		Slave:      targets(servers),
+		Timeout:    time.Second,
+		Collectors: map[string]bool{"master_snapshot": true, "master_state": true, "agent_snapshot": true, "agent_state": true},
+	}
+	e := newExporter(func() (*config, error) { return cfg, cfg.validate() })
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := e.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "mesos_master_uptime_seconds", "mesos_slave_uptime_seconds":
+			for _, m := range mf.Metric {
+				got[mf.GetName()] = append(got[mf.GetName()], labelKey(m.GetLabel(), []string{"mesos_role", "mesos_target"}))
+			}
+		}
+	}
+	want := map[string][]string{
+		"mesos_master_uptime_seconds": {"master/"},
+		"mesos_slave_uptime_seconds":  {"agent/" + servers[0], "agent/" + servers[1]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got series %v, want %v", got, want)
+	}
+}
+
+// constCollector collects a gauge with a help text, whose descriptor conflicts
+// with those of other help texts.
+type constCollector string
+
+func (c constCollector) desc() *prometheus.Desc {
+	return prometheus.NewDesc("mesos_test_value", string(c), nil, nil)
+}
+
+func (c constCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc()
+}
+
+func (c constCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc(), prometheus.GaugeValue, 1)
+}
+
+func TestExporterReloadConflict(t *testing.T) {
+	for _, name := range []string{"agent_test_a", "agent_test_b"} {
+		help := name
+		collectorFactories[name] = collectorFactory{new: func(ctx context.Context, cfg *config, client *httpClient) prometheus.Collector {
+			return constCollector(help)
+		}}
+		defer delete(collectorFactories, name)
+	}
+
+	cfg := &config{Slave: targets{"http://localhost:5051"}, Timeout: time.Second, Collectors: map[string]bool{"agent_test_a": true}}
+	e := newExporter(func() (*config, error) { return cfg, cfg.validate() })
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	collectors := e.collectors
+
+	cfg = &config{Slave: targets{"http://localhost:5051"}, Timeout: time.Second, Collectors: map[string]bool{"agent_test_a": true, "agent_test_b": true}}
+	if err := e.reload(); err == nil {
+		t.Fatal("expected error reloading conflicting collectors")
+	}
+	if !reflect.DeepEqual(e.collectors, collectors) {
+		t.Error("collectors replaced by conflicting configuration")
+	}
+}
+
+func TestMergedGatherersDuplicates(t *testing.T) {
+	var gatherers mergedGatherers
+	for _, help := range []string{"a", "b"} {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(constCollector(help))
+		gatherers = append(gatherers, registry)
+	}
+
+	mfs, err := gatherers.Gather()
+	if err == nil {
+		t.Error("expected error gathering duplicate series")
+	}
+	if len(mfs) != 1 || len(mfs[0].Metric) != 1 {
+		t.Errorf("got %v, want a single series", mfs)
+	}
+}
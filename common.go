@@ -1,16 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -33,6 +33,23 @@ type (
 		Labels      []label   `json:"labels"`
 		Resources   resources `json:"resources"`
 		Statuses    []status  `json:"statuses"`
+		// Discovery holds the ports of the service discovery of tasks.
+		Discovery *discoveryInfo `json:"discovery"`
+	}
+
+	discoveryInfo struct {
+		Ports struct {
+			Ports []discoveryPort `json:"ports"`
+		} `json:"ports"`
+	}
+
+	discoveryPort struct {
+		Number   uint32 `json:"number"`
+		Name     string `json:"name"`
+		Protocol string `json:"protocol"`
+		Labels   struct {
+			Labels []label `json:"labels"`
+		} `json:"labels"`
 	}
 
 	label struct {
@@ -144,23 +161,18 @@ func counter(subsystem, name, help string, labels ...string) *settableCounterVec
 	}
 }
 
-type authInfo struct {
-	username      string
-	password      string
-	loginURL      string
-	token         string
-	tokenExpire   int64
-	signingKey    []byte
-	strictMode    bool
-	privateKey    string
-	skipSSLVerify bool
-}
-
 type httpClient struct {
 	http.Client
 	url       string
-	auth      authInfo
+	auth      authProvider
 	userAgent string
+	// operatorAPI is the content type used to query the v1 Operator API
+	// instead of the legacy endpoints, or empty to use the legacy endpoints.
+	operatorAPI string
+	// timeouts overrides the client timeout for endpoints by path.
+	timeouts map[string]time.Duration
+	// health records the outcome of the fetches for readiness.
+	health *fetchHealth
 }
 
 type metricCollector struct {
@@ -172,81 +184,14 @@ func newMetricCollector(httpClient *httpClient, metrics map[prometheus.Collector
 	return &metricCollector{httpClient, metrics}
 }
 
-func signingToken(httpClient *httpClient) string {
-	signKey, err := jwt.ParseRSAPrivateKeyFromPEM(httpClient.auth.signingKey)
-	if err != nil {
-		log.WithField("error", err).Error("Error parsing privateKey")
-	}
-
-	expireToken := time.Now().Add(time.Hour * 1).Unix()
-	httpClient.auth.tokenExpire = expireToken
-
-	// Create the token
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"uid": httpClient.auth.username,
-		"exp": expireToken,
+func (httpClient *httpClient) fetchAndDecode(endpoint string, target interface{}) bool {
+	return httpClient.fetchAndStream(endpoint, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&target)
 	})
-	log.WithFields(log.Fields{
-		"uid":     httpClient.auth.username,
-		"expires": expireToken,
-	}).Debug("creating token")
-	// Sign and get the complete encoded token as a string
-	tokenString, err := token.SignedString(signKey)
-	if err != nil {
-		log.WithField("error", err).Error("Error creating login token")
-		return ""
-	}
-	return tokenString
-}
-
-func authToken(httpClient *httpClient) string {
-	currentTime := time.Now().Unix()
-	if currentTime > httpClient.auth.tokenExpire {
-		url := httpClient.auth.loginURL
-		signingToken := signingToken(httpClient)
-		body, err := json.Marshal(&tokenRequest{UID: httpClient.auth.username, Token: signingToken})
-		if err != nil {
-			log.WithField("error", err).Error("Error creating JSON request")
-			return ""
-		}
-		buffer := bytes.NewBuffer(body)
-		req, err := http.NewRequest("POST", url, buffer)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"url":   url,
-				"error": err,
-			}).Error("Error creating HTTP request")
-			return ""
-		}
-		req.Header.Add("User-Agent", httpClient.userAgent)
-		req.Header.Add("Content-Type", "application/json")
-		res, err := httpClient.Do(req)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"url":   url,
-				"error": err,
-			}).Error("Error fetching URL")
-			errorCounter.Inc()
-			return ""
-		}
-		defer res.Body.Close()
-
-		var token tokenResponse
-		if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
-			log.WithFields(log.Fields{
-				"url":   url,
-				"error": err,
-			}).Error("Error decoding response body")
-			errorCounter.Inc()
-			return ""
-		}
-
-		httpClient.auth.token = fmt.Sprintf("token=%s", token.Token)
-	}
-	return httpClient.auth.token
 }
 
-func (httpClient *httpClient) fetchAndDecode(endpoint string, target interface{}) bool {
+// fetchAndStream fetches an endpoint and passes the response body to decode.
+func (httpClient *httpClient) fetchAndStream(endpoint string, decode func(io.Reader) error) bool {
 	url := strings.TrimSuffix(httpClient.url, "/") + endpoint
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -256,41 +201,95 @@ func (httpClient *httpClient) fetchAndDecode(endpoint string, target interface{}
 		}).Error("Error creating HTTP request")
 		return false
 	}
+	return httpClient.doAndStream(req, decode)
+}
+
+func (httpClient *httpClient) doAndDecode(req *http.Request, target interface{}) bool {
+	return httpClient.doAndStream(req, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&target)
+	})
+}
+
+func (httpClient *httpClient) doAndStream(req *http.Request, decode func(io.Reader) error) bool {
+	res, ok := httpClient.do(req)
+	if !ok {
+		return false
+	}
+	defer res.Body.Close()
+
+	if err := decode(res.Body); err != nil {
+		log.WithFields(log.Fields{
+			"url":   req.URL.String(),
+			"error": err,
+		}).Error("Error decoding response body")
+		errorCounter.Inc()
+		httpClient.health.record(req.URL.String(), err)
+		return false
+	}
+
+	return true
+}
+
+// do sends an authenticated request. Responses with an error status are
+// closed and fail. The caller must close the response body if ok is true.
+func (httpClient *httpClient) do(req *http.Request) (res *http.Response, ok bool) {
+	url := req.URL.String()
 	req.Header.Add("User-Agent", httpClient.userAgent)
-	if httpClient.auth.username != "" && httpClient.auth.password != "" {
-		req.SetBasicAuth(httpClient.auth.username, httpClient.auth.password)
+	if httpClient.auth != nil {
+		if err := httpClient.auth.authenticate(req); err != nil {
+			log.WithFields(log.Fields{
+				"url":   url,
+				"error": err,
+			}).Error("Error authenticating request")
+			errorCounter.Inc()
+			httpClient.health.record(url, err)
+			return nil, false
+		}
 	}
-	if httpClient.auth.strictMode {
-		req.Header.Add("Authorization", authToken(httpClient))
+	client := &httpClient.Client
+	endpoint := strings.SplitN(strings.TrimPrefix(url, strings.TrimSuffix(httpClient.url, "/")), "?", 2)[0]
+	if timeout, ok := httpClient.timeouts[endpoint]; ok {
+		withTimeout := httpClient.Client
+		withTimeout.Timeout = timeout
+		client = &withTimeout
 	}
 	log.WithField("url", url).Debug("fetching URL")
-	res, err := httpClient.Do(req)
+	res, err := client.Do(req)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"url":   url,
 			"error": err,
 		}).Error("Error fetching URL")
 		errorCounter.Inc()
-		return false
+		httpClient.health.record(url, err)
+		return nil, false
 	}
-	defer res.Body.Close()
-
-	if err := json.NewDecoder(res.Body).Decode(&target); err != nil {
+	if res.StatusCode >= http.StatusBadRequest {
+		res.Body.Close()
+		err := fmt.Errorf("unexpected status: %s", res.Status)
 		log.WithFields(log.Fields{
 			"url":   url,
 			"error": err,
-		}).Error("Error decoding response body")
+		}).Error("Error fetching URL")
 		errorCounter.Inc()
-		return false
+		httpClient.health.record(url, err)
+		return nil, false
 	}
-
-	return true
+	httpClient.health.record(url, nil)
+	return res, true
 }
 
 func (c *metricCollector) Collect(ch chan<- prometheus.Metric) {
 	var m metricMap
-	log.WithField("url", "/metrics/snapshot").Debug("fetching URL")
-	c.fetchAndDecode("/metrics/snapshot", &m)
+	if c.operatorAPI != "" {
+		var res getMetricsResponse
+		log.WithField("call", "GET_METRICS").Debug("calling operator API")
+		c.callOperator("GET_METRICS", &res)
+		m = res.metricMap()
+	} else {
+		log.WithField("url", "/metrics/snapshot").Debug("fetching URL")
+		c.fetchAndDecode("/metrics/snapshot", &m)
+	}
 	for cm, f := range c.metrics {
 		if err := f(m, cm); err != nil {
 			ch := make(chan *prometheus.Desc, 1)
@@ -318,14 +317,6 @@ func normaliseLabel(label string) string {
 	return invalidLabelNameCharRE.ReplaceAllString(label, "_")
 }
 
-func normaliseLabelList(labelList []string) []string {
-	normalisedLabelList := []string{}
-	for _, label := range labelList {
-		normalisedLabelList = append(normalisedLabelList, normaliseLabel(label))
-	}
-	return normalisedLabelList
-}
-
 func stringInSlice(string string, slice []string) bool {
 	for _, elem := range slice {
 		if string == elem {
@@ -345,16 +336,100 @@ func getLabelValuesFromMap(labels prometheus.Labels, orderedLabelKeys []string)
 
 var (
 	text             = regexp.MustCompile("^[-[:word:]/.]*$")
-	errDropAttribute = errors.New("value neither scalar nor text")
+	errDropAttribute = errors.New("value neither scalar, text, ranges nor set")
 )
 
-// attributeString converts a text attribute in json.RawMessage to string.
+// attributeString converts an attribute in json.RawMessage to string.
 // see http://mesos.apache.org/documentation/latest/attributes-resources/
 // for more information.  note that scalar matches text for this purpose.
+// Ranges and sets are rendered in a canonical form: ranges sorted and merged
+// as in "[9-12,15-20]", and set items sorted and deduplicated as in "{a,b}".
 // attributeString returns string or errDropAttribute.
 func attributeString(attribute json.RawMessage) (string, error) {
-	if value := strings.Trim(string(attribute), `"`); text.MatchString(value) {
-		return value, nil
+	value, _, err := parseAttribute(attribute)
+	return value, err
+}
+
+// parseAttribute returns the canonical string of an attribute and its
+// elements: the ranges of a ranges attribute, the items of a set attribute,
+// or the value itself of a scalar or text attribute.
+func parseAttribute(attribute json.RawMessage) (string, []string, error) {
+	value := strings.Trim(string(attribute), `"`)
+	switch {
+	case text.MatchString(value):
+		return value, []string{value}, nil
+	case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+		var rs ranges
+		if err := rs.UnmarshalJSON([]byte(value)); err != nil {
+			return "", nil, errDropAttribute
+		}
+		sort.Slice(rs, func(i, j int) bool { return rs[i][0] < rs[j][0] })
+		var merged ranges
+		for _, r := range rs {
+			if r[0] > r[1] {
+				return "", nil, errDropAttribute
+			}
+			if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+				if r[1] > merged[n-1][1] {
+					merged[n-1][1] = r[1]
+				}
+				continue
+			}
+			merged = append(merged, r)
+		}
+		elements := make([]string, len(merged))
+		for i, r := range merged {
+			elements[i] = fmt.Sprintf("%d-%d", r[0], r[1])
+		}
+		return "[" + strings.Join(elements, ",") + "]", elements, nil
+	case strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}"):
+		var elements []string
+		if items := strings.TrimSpace(value[1 : len(value)-1]); items != "" {
+			for _, item := range strings.Split(items, ",") {
+				item = strings.TrimSpace(item)
+				if item == "" || !text.MatchString(item) {
+					return "", nil, errDropAttribute
+				}
+				if !stringInSlice(item, elements) {
+					elements = append(elements, item)
+				}
+			}
+		}
+		sort.Strings(elements)
+		return "{" + strings.Join(elements, ",") + "}", elements, nil
+	}
+	return "", nil, errDropAttribute
+}
+
+// attributeSeries converts the attributes to strings, dropping those which
+// cannot be converted. It returns the attributes of a single series or, if
+// attributes whose keys are in explode are ranges or sets, of a series per
+// combination of their elements.
+func attributeSeries(attributes map[string]json.RawMessage, explode []string) []map[string]string {
+	series := []map[string]string{{}}
+	for key, attribute := range attributes {
+		value, elements, err := parseAttribute(attribute)
+		if err != nil {
+			continue
+		}
+		if !stringInSlice(key, explode) || len(elements) == 0 {
+			for _, s := range series {
+				s[key] = value
+			}
+			continue
+		}
+		exploded := make([]map[string]string, 0, len(series)*len(elements))
+		for _, s := range series {
+			for _, element := range elements {
+				e := make(map[string]string, len(s)+1)
+				for k, v := range s {
+					e[k] = v
+				}
+				e[key] = element
+				exploded = append(exploded, e)
+			}
+		}
+		series = exploded
 	}
-	return "", errDropAttribute
+	return series
 }
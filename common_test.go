@@ -3,6 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func Example_attributeString() {
@@ -11,6 +16,10 @@ func Example_attributeString() {
 		"6",
 		"9.3",
 		"[9-12]",
+		`"[31000-32000, 9-12, 13-14]"`,
+		"[12-9]",
+		`"{b, a,b}"`,
+		"{}",
 		"{a: b}",
 	}
 	for _, test := range tests {
@@ -21,6 +30,75 @@ func Example_attributeString() {
 	// text <nil>
 	// 6 <nil>
 	// 9.3 <nil>
-	//  value neither scalar nor text
-	//  value neither scalar nor text
+	// [9-12] <nil>
+	// [9-14,31000-32000] <nil>
+	//  value neither scalar, text, ranges nor set
+	// {a,b} <nil>
+	// {} <nil>
+	//  value neither scalar, text, ranges nor set
+}
+
+func TestAttributeSeries(t *testing.T) {
+	attributes := map[string]json.RawMessage{
+		"rack":  json.RawMessage(`"r1"`),
+		"ports": json.RawMessage(`"[31000-31009, 9-12]"`),
+		"zones": json.RawMessage(`"{b,a}"`),
+		"gpus":  json.RawMessage(`{"a": 1}`),
+	}
+
+	for _, tt := range []struct {
+		explode []string
+		want    []string
+	}{
+		{nil, []string{"rack=r1 ports=[9-12,31000-31009] zones={a,b}"}},
+		{[]string{"rack", "zones"}, []string{
+			"rack=r1 ports=[9-12,31000-31009] zones=a",
+			"rack=r1 ports=[9-12,31000-31009] zones=b",
+		}},
+		{[]string{"ports", "zones"}, []string{
+			"rack=r1 ports=31000-31009 zones=a",
+			"rack=r1 ports=31000-31009 zones=b",
+			"rack=r1 ports=9-12 zones=a",
+			"rack=r1 ports=9-12 zones=b",
+		}},
+	} {
+		var got []string
+		for _, s := range attributeSeries(attributes, tt.explode) {
+			got = append(got, fmt.Sprintf("rack=%s ports=%s zones=%s", s["rack"], s["ports"], s["zones"]))
+			if _, ok := s["gpus"]; ok {
+				t.Errorf("%v: unexpected attribute gpus in %v", tt.explode, s)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.explode, got, tt.want)
+		}
+	}
+}
+
+// gatherValues collects a collector and returns the values of its metrics by
+// name and labels, e.g. mesos_master_role_weight{role=eng}.
+func gatherValues(t *testing.T, c prometheus.Collector) map[string]float64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			}
+			values[mf.GetName()+"{"+labelString(m.GetLabel())+"}"] = value
+		}
+	}
+	return values
 }
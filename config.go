@@ -0,0 +1,357 @@
+// Configuration of the exporter, either from the command line flags or from
+// a YAML file given with -config.file. Settings missing from the file are
+// taken from the flags, so a file may contain just the settings that need
+// to be reloadable. The master and slave targets are either a URL or a list
+// of URLs. An example covering all settings:
+//
+//	master: http://localhost:5050
+//	slave: [http://localhost:5051]
+//	timeout: 10s
+//	endpoint_timeouts:
+//	  /state: 30s
+//	ready_grace_period: 1m
+//	collectors:
+//	  master_snapshot: true
+//	  master_state: true
+//	  master_roles: true
+//	  master_maintenance: false
+//	master_state_endpoint: /slaves
+//	master_events: false
+//	task_transitions_drop_labels: [reason]
+//	operator_api:
+//	  collectors: [master_snapshot]
+//	  content_type: protobuf
+//	service_discovery:
+//	  agent_port: 9105
+//	  tasks: true
+//	  refresh_interval: 30s
+//	  file: /etc/prometheus/file_sd/mesos_agents.json
+//	  file_interval: 1m
+//	exported_task_labels: [owner, "com.example/*", "/team[-_]name/", HAPROXY_0_VHOST=vhost]
+//	exported_task_labels_prefix: task_label_
+//	exported_slave_attributes: [rack]
+//	exported_slave_attributes_prefix: ""
+//	exploded_slave_attributes: [ports]
+//	allow_metrics: mesos_(master|slave)_.*
+//	deny_metrics: mesos_slave_task_labels
+//	metric_relabel_configs:
+//	  - source_labels: [__name__, role]
+//	    regex: mesos_master_allocator_.*;(slave_public|.*-dev)
+//	    action: drop
+//	  - regex: framework_id
+//	    action: labeldrop
+//	series_limits:
+//	  mesos_slave_task_labels: 1000
+//	series_limit_overflow: aggregate
+//	auth:
+//	  username: exporter
+//	  password: secret
+//	  password_file: ""
+//	  strict_mode: false
+//	  private_key: ""
+//	  private_key_file: /etc/mesos_exporter/key.json
+//	  login_url: https://leader.mesos/acs/api/v1/auth/login
+//	  bearer_token_file: ""
+//	  oauth2:
+//	    token_url: https://idp.example.com/oauth2/token
+//	    client_id: mesos_exporter
+//	    client_secret: ""
+//	    client_secret_file: /etc/mesos_exporter/client_secret
+//	    scopes: [mesos]
+//	tls:
+//	  trusted_certs: [/etc/ssl/mesos-ca.pem]
+//	  client_cert: /etc/ssl/exporter.pem
+//	  client_key: /etc/ssl/exporter-key.pem
+//	  skip_ssl_verify: false
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	config struct {
+		Master targets `yaml:"master"`
+		Slave  targets `yaml:"slave"`
+
+		Timeout time.Duration `yaml:"timeout"`
+		// EndpointTimeouts overrides Timeout for the endpoints given by
+		// their path, e.g. /state or /api/v1.
+		EndpointTimeouts map[string]time.Duration `yaml:"endpoint_timeouts"`
+		// ReadyGracePeriod is how long the fetches of an endpoint may fail
+		// before the exporter is not ready, see health.go.
+		ReadyGracePeriod time.Duration `yaml:"ready_grace_period"`
+
+		Collectors                map[string]bool `yaml:"collectors"`
+		MasterStateEndpoint       string          `yaml:"master_state_endpoint"`
+		MasterEvents              bool            `yaml:"master_events"`
+		TaskTransitionsDropLabels []string        `yaml:"task_transitions_drop_labels"`
+		OperatorAPI               struct {
+			Collectors  []string `yaml:"collectors"`
+			ContentType string   `yaml:"content_type"`
+		} `yaml:"operator_api"`
+
+		// ServiceDiscovery configures the Prometheus service discovery of
+		// the agents and tasks of the masters, see sd.go.
+		ServiceDiscovery struct {
+			// AgentPort replaces the port of the agent targets, e.g.
+			// with the port of an exporter running on every agent.
+			AgentPort int  `yaml:"agent_port"`
+			Tasks     bool `yaml:"tasks"`
+			// RefreshInterval is the minimum interval between fetches of
+			// the agents and tasks from the masters.
+			RefreshInterval time.Duration `yaml:"refresh_interval"`
+			// File is written with the agents every FileInterval in
+			// the file_sd format, JSON or YAML by its extension.
+			File         string        `yaml:"file"`
+			FileInterval time.Duration `yaml:"file_interval"`
+		} `yaml:"service_discovery"`
+
+		// ExportedTaskLabels and ExportedSlaveAttributes select the task
+		// labels and agent attributes exported as labels, see labels.go.
+		ExportedTaskLabels            []string `yaml:"exported_task_labels"`
+		ExportedTaskLabelsPrefix      string   `yaml:"exported_task_labels_prefix"`
+		ExportedSlaveAttributes       []string `yaml:"exported_slave_attributes"`
+		ExportedSlaveAttributesPrefix string   `yaml:"exported_slave_attributes_prefix"`
+		// ExplodedSlaveAttributes are the keys of the range and set
+		// attributes exported as a series per range or item.
+		ExplodedSlaveAttributes []string `yaml:"exploded_slave_attributes"`
+
+		// AllowMetrics and DenyMetrics select the exported metrics by
+		// name, before MetricRelabelConfigs are applied to them.
+		AllowMetrics         regex            `yaml:"allow_metrics"`
+		DenyMetrics          regex            `yaml:"deny_metrics"`
+		MetricRelabelConfigs []*relabelConfig `yaml:"metric_relabel_configs"`
+
+		// SeriesLimits limits the number of series of metrics by name. The
+		// excess series are aggregated, or dropped if SeriesLimitOverflow
+		// is drop.
+		SeriesLimits        map[string]int `yaml:"series_limits"`
+		SeriesLimitOverflow string         `yaml:"series_limit_overflow"`
+
+		// Auth holds secrets, which are never logged. The *File settings
+		// read them from files instead, which are read again when they
+		// change.
+		Auth struct {
+			Username       string `yaml:"username"`
+			Password       secret `yaml:"password"`
+			PasswordFile   string `yaml:"password_file"`
+			StrictMode     bool   `yaml:"strict_mode"`
+			PrivateKey     secret `yaml:"private_key"`
+			PrivateKeyFile string `yaml:"private_key_file"`
+			LoginURL       string `yaml:"login_url"`
+			// BearerTokenFile and OAuth2 select the bearer token and
+			// OAuth2 client credentials providers, see auth.go.
+			BearerTokenFile string `yaml:"bearer_token_file"`
+			OAuth2          struct {
+				TokenURL         string   `yaml:"token_url"`
+				ClientID         string   `yaml:"client_id"`
+				ClientSecret     secret   `yaml:"client_secret"`
+				ClientSecretFile string   `yaml:"client_secret_file"`
+				Scopes           []string `yaml:"scopes"`
+			} `yaml:"oauth2"`
+		} `yaml:"auth"`
+
+		TLS struct {
+			TrustedCerts  []string `yaml:"trusted_certs"`
+			ClientCert    string   `yaml:"client_cert"`
+			ClientKey     string   `yaml:"client_key"`
+			SkipSSLVerify bool     `yaml:"skip_ssl_verify"`
+		} `yaml:"tls"`
+	}
+
+	// targets are the URLs of masters or agents.
+	targets []string
+
+	// secret is a credential, which is redacted when printed or marshaled.
+	secret string
+)
+
+func (s secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "<secret>"
+}
+
+// GoString redacts secrets printed with %#v.
+func (s secret) GoString() string { return s.String() }
+
+// MarshalYAML redacts secrets.
+func (s secret) MarshalYAML() (interface{}, error) { return s.String(), nil }
+
+// UnmarshalYAML accepts a single URL as well as a list of URLs.
+func (t *targets) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var url string
+	if err := unmarshal(&url); err == nil {
+		*t = csvInputToList(url)
+		return nil
+	}
+	return unmarshal((*[]string)(t))
+}
+
+// loadConfig reads the YAML configuration file and applies it on top of
+// defaults.
+func loadConfig(file string, defaults *config) (*config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Maps are merged with the defaults after parsing, as the strict mode
+	// of yaml.UnmarshalStrict rejects keys already present.
+	cfg := *defaults
+	cfg.Collectors, cfg.EndpointTimeouts, cfg.SeriesLimits = nil, nil, nil
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", file, err)
+	}
+	if cfg.Collectors == nil {
+		cfg.Collectors = map[string]bool{}
+	}
+	for name, enabled := range defaults.Collectors {
+		if _, ok := cfg.Collectors[name]; !ok {
+			cfg.Collectors[name] = enabled
+		}
+	}
+	if cfg.EndpointTimeouts == nil {
+		cfg.EndpointTimeouts = map[string]time.Duration{}
+	}
+	for endpoint, timeout := range defaults.EndpointTimeouts {
+		if _, ok := cfg.EndpointTimeouts[endpoint]; !ok {
+			cfg.EndpointTimeouts[endpoint] = timeout
+		}
+	}
+	if cfg.SeriesLimits == nil {
+		cfg.SeriesLimits = map[string]int{}
+	}
+	for metric, limit := range defaults.SeriesLimits {
+		if _, ok := cfg.SeriesLimits[metric]; !ok {
+			cfg.SeriesLimits[metric] = limit
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s: %v", file, err)
+	}
+	return &cfg, nil
+}
+
+// validate checks the configuration for errors that would otherwise only
+// surface when collecting.
+func (cfg *config) validate() error {
+	switch {
+	case len(cfg.Master) == 0 && len(cfg.Slave) == 0:
+		return errors.New("a master or slave is required")
+	case cfg.Timeout <= 0:
+		return errors.New("timeout must be positive")
+	case cfg.ReadyGracePeriod < 0:
+		return errors.New("ready grace period must not be negative")
+	case cfg.ServiceDiscovery.AgentPort < 0 || cfg.ServiceDiscovery.AgentPort > 65535:
+		return fmt.Errorf("invalid service discovery agent port %d", cfg.ServiceDiscovery.AgentPort)
+	case cfg.ServiceDiscovery.RefreshInterval < 0:
+		return errors.New("service discovery refresh interval must not be negative")
+	case cfg.ServiceDiscovery.File != "" && sdFileFormat(cfg.ServiceDiscovery.File) == "":
+		return fmt.Errorf("service discovery file %q must end in .json, .yml or .yaml", cfg.ServiceDiscovery.File)
+	case cfg.ServiceDiscovery.File != "" && cfg.ServiceDiscovery.FileInterval <= 0:
+		return errors.New("service discovery file interval must be positive")
+	case cfg.Auth.StrictMode && (cfg.Auth.BearerTokenFile != "" || cfg.Auth.OAuth2.TokenURL != ""),
+		cfg.Auth.BearerTokenFile != "" && cfg.Auth.OAuth2.TokenURL != "":
+		return errors.New("only one of strict mode, bearer token file and OAuth2 authentication can be used")
+	case cfg.Auth.Password != "" && cfg.Auth.PasswordFile != "",
+		cfg.Auth.PrivateKey != "" && cfg.Auth.PrivateKeyFile != "",
+		cfg.Auth.OAuth2.ClientSecret != "" && cfg.Auth.OAuth2.ClientSecretFile != "":
+		return errors.New("a secret and its file cannot both be given")
+	case cfg.Auth.OAuth2.TokenURL != "" && cfg.Auth.OAuth2.ClientID == "":
+		return errors.New("OAuth2 authentication requires a client ID")
+	case (cfg.TLS.ClientCert == "") != (cfg.TLS.ClientKey == ""):
+		return errors.New("must supply both client cert and client key to use TLS mutual auth")
+	}
+
+	for endpoint, timeout := range cfg.EndpointTimeouts {
+		if !strings.HasPrefix(endpoint, "/") || timeout <= 0 {
+			return fmt.Errorf("invalid timeout %s for endpoint %q", timeout, endpoint)
+		}
+	}
+
+	for name := range cfg.Collectors {
+		if _, ok := collectorFactories[name]; !ok {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+
+	switch strings.SplitN(cfg.MasterStateEndpoint, "?", 2)[0] {
+	case "", "/state", "/state-summary", "/slaves":
+	default:
+		return fmt.Errorf("invalid master state endpoint %q", cfg.MasterStateEndpoint)
+	}
+
+	for _, label := range cfg.TaskTransitionsDropLabels {
+		if label != "framework" && label != "reason" {
+			return fmt.Errorf("label %q cannot be dropped from task transitions, only framework and reason can", label)
+		}
+	}
+
+	if _, err := cfg.taskLabelSelector(); err != nil {
+		return fmt.Errorf("exported task labels: %v", err)
+	}
+	if _, err := cfg.slaveAttributeSelector(); err != nil {
+		return fmt.Errorf("exported slave attributes: %v", err)
+	}
+
+	for metric, limit := range cfg.SeriesLimits {
+		if limit <= 0 {
+			return fmt.Errorf("series limit of %s must be positive", metric)
+		}
+	}
+	switch cfg.SeriesLimitOverflow {
+	case "", "aggregate", "drop":
+	default:
+		return fmt.Errorf("invalid series limit overflow %q, must be aggregate or drop", cfg.SeriesLimitOverflow)
+	}
+
+	for i, rule := range cfg.MetricRelabelConfigs {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("metric relabel config #%d: %v", i+1, err)
+		}
+	}
+
+	if _, err := cfg.operatorContentType(); err != nil {
+		return err
+	}
+	for _, name := range cfg.OperatorAPI.Collectors {
+		switch name {
+		case "master_snapshot", "master_state", "agent_snapshot", "agent_monitor":
+		default:
+			return fmt.Errorf("operator API not supported by collector %q", name)
+		}
+	}
+	return nil
+}
+
+// operatorContentType returns the content type used for the v1 Operator API.
+func (cfg *config) operatorContentType() (string, error) {
+	switch cfg.OperatorAPI.ContentType {
+	case "", "json":
+		return operatorJSON, nil
+	case "protobuf":
+		return operatorProtobuf, nil
+	}
+	return "", fmt.Errorf("invalid operator API content type %q", cfg.OperatorAPI.ContentType)
+}
+
+// taskLabelSelector returns the selector of the task labels exported by
+// "mesos_slave_task_labels".
+func (cfg *config) taskLabelSelector() (*labelSelector, error) {
+	return newLabelSelector(cfg.ExportedTaskLabels, cfg.ExportedTaskLabelsPrefix, defaultTaskLabels)
+}
+
+// slaveAttributeSelector returns the selector of the agent attributes
+// exported by "mesos_slave_attributes".
+func (cfg *config) slaveAttributeSelector() (*labelSelector, error) {
+	return newLabelSelector(cfg.ExportedSlaveAttributes, cfg.ExportedSlaveAttributesPrefix, []string{"slave"})
+}
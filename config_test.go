@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	file := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaults := &config{
+		Slave:      targets{"http://localhost:5051"},
+		Timeout:    10 * time.Second,
+		Collectors: map[string]bool{"master_state": true, "master_roles": true},
+	}
+
+	cfg, err := loadConfig(writeConfig(t, dir, `
+slave: ""
+master: http://localhost:5050
+endpoint_timeouts:
+  /state: 30s
+collectors:
+  master_roles: false
+exported_slave_attributes: [rack]
+`), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Master, targets{"http://localhost:5050"}) || len(cfg.Slave) != 0 || cfg.Timeout != 10*time.Second {
+		t.Errorf("unexpected target or timeout: %+v", cfg)
+	}
+	if want := map[string]bool{"master_state": true, "master_roles": false}; !reflect.DeepEqual(cfg.Collectors, want) {
+		t.Errorf("got collectors %v, want %v", cfg.Collectors, want)
+	}
+	if !defaults.Collectors["master_roles"] {
+		t.Error("defaults modified by loading the configuration")
+	}
+	if cfg.EndpointTimeouts["/state"] != 30*time.Second {
+		t.Errorf("got endpoint timeouts %v", cfg.EndpointTimeouts)
+	}
+
+	cfg, err = loadConfig(writeConfig(t, dir, "master: [http://master1:5050, http://master2:5050]"), defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (targets{"http://master1:5050", "http://master2:5050"}); !reflect.DeepEqual(cfg.Master, want) {
+		t.Errorf("got masters %v, want %v", cfg.Master, want)
+	}
+
+	for content, want := range map[string]string{
+		"unknown_field: 1":                                    "not found",
+		"slave: []":                                           "master or slave is required",
+		"slave: {url: http://localhost:5051}":                 "cannot unmarshal",
+		"collectors: {master_foo: true}":                      "unknown collector",
+		"endpoint_timeouts: {state: 1s}":                      "invalid timeout",
+		"operator_api: {content_type: xml}":                   "content type",
+		"task_transitions_drop_labels: [foo]":                 "cannot be dropped",
+		"metric_relabel_configs: [{action: foo}]":             "unknown relabel action",
+		"series_limits: {mesos_slave_task_labels: 0}":         "must be positive",
+		"series_limit_overflow: truncate":                     "invalid series limit overflow",
+		"allow_metrics: \"(\"":                                "missing closing )",
+		"auth: {strict_mode: true, bearer_token_file: token}": "only one of",
+		"auth: {oauth2: {token_url: http://idp/token}}":       "requires a client ID",
+		"auth: {password: secret, password_file: password}":   "cannot both be given",
+		"service_discovery: {file: agents.txt}":               "must end in .json",
+		"service_discovery: {refresh_interval: -1s}":          "must not be negative",
+	} {
+		_, err := loadConfig(writeConfig(t, dir, content), defaults)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("config %q: got error %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestExporterReload(t *testing.T) {
+	cfg := &config{Slave: targets{"http://localhost:5051"}, Timeout: time.Second}
+	e := newExporter(func() (*config, error) { return cfg, cfg.validate() })
+
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	collectors := e.collectors
+
+	cfg = &config{}
+	if err := e.reload(); err == nil {
+		t.Fatal("expected error reloading invalid configuration")
+	}
+	if !reflect.DeepEqual(e.collectors, collectors) {
+		t.Error("collectors replaced by invalid configuration")
+	}
+}
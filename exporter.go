@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mesos",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configLastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mesos",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+// exporter gathers the metrics of the collectors built from the current
+// configuration, and rebuilds them on reload.
+type exporter struct {
+	load func() (*config, error)
+
+	// health records the fetches of all configurations, for readiness.
+	health *fetchHealth
+
+	mu      sync.RWMutex
+	cfg     *config
+	limiter *seriesLimiter
+	sd      *serviceDiscovery
+	// collectors are the gatherers of the enabled collectors by name.
+	collectors map[string]prometheus.Gatherer
+	stop       func()
+}
+
+func newExporter(load func() (*config, error)) *exporter {
+	return &exporter{load: load, health: newFetchHealth(), stop: func() {}}
+}
+
+// reload loads the configuration and replaces the collectors. The previous
+// collectors are kept if the configuration is invalid. The fetches of the
+// targets of the new configuration are kept for readiness.
+func (e *exporter) reload() error {
+	cfg, collectors, sd, stop, err := e.build()
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return err
+	}
+
+	e.mu.Lock()
+	previousStop := e.stop
+	e.cfg, e.collectors, e.sd, e.stop = cfg, collectors, sd, stop
+	e.limiter = newSeriesLimiter(cfg)
+	e.mu.Unlock()
+	previousStop()
+	e.health.retain(append(append([]string{}, cfg.Master...), cfg.Slave...))
+
+	configLastReloadSuccessful.Set(1)
+	configLastReloadSuccessTimestamp.Set(float64(time.Now().Unix()))
+	return nil
+}
+
+func (e *exporter) build() (*config, map[string]prometheus.Gatherer, *serviceDiscovery, func(), error) {
+	cfg, err := e.load()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	// Only the certificates of the files of the new configuration are
+	// exported, unless it is not applied.
+	previousCerts := certificateExpiry.reset()
+	newClient, err := cfg.clientFactory()
+	if err != nil {
+		certificateExpiry.restore(previousCerts)
+		return nil, nil, nil, nil, err
+	}
+	// The clients of the collectors and the service discovery record their
+	// fetches for readiness.
+	newHealthClient := func(url string) *httpClient {
+		client := newClient(url)
+		client.health = e.health
+		return client
+	}
+	collectors, stop, err := newCollectors(cfg, newHealthClient)
+	if err != nil {
+		certificateExpiry.restore(previousCerts)
+		return nil, nil, nil, nil, err
+	}
+	sd := newServiceDiscovery(cfg, newHealthClient)
+	if cfg.ServiceDiscovery.File != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		go sd.writeFile(ctx, cfg.ServiceDiscovery.File, cfg.ServiceDiscovery.FileInterval)
+		stopCollectors := stop
+		stop = func() {
+			cancel()
+			stopCollectors()
+		}
+	}
+	return cfg, collectors, sd, stop, nil
+}
+
+// ready returns an error if the fetches of an endpoint by the current
+// collectors have been failing for longer than the grace period.
+func (e *exporter) ready() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.cfg == nil {
+		return errors.New("configuration not loaded")
+	}
+	return e.health.ready(e.cfg.ReadyGracePeriod)
+}
+
+// serviceDiscovery returns the service discovery of the current
+// configuration.
+func (e *exporter) serviceDiscovery() *serviceDiscovery {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.sd
+}
+
+func (e *exporter) Gather() ([]*dto.MetricFamily, error) {
+	g, _ := e.gatherer(nil)
+	return g.Gather()
+}
+
+// gatherer returns a gatherer of the named collectors, or of all enabled
+// collectors if names is empty, with the metric filters, relabel rules and
+// series limits applied. It fails if a collector is not enabled.
+func (e *exporter) gatherer(names []string) (prometheus.Gatherer, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(names) == 0 {
+		for name := range e.collectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var gatherers mergedGatherers
+	for i, name := range names {
+		if stringInSlice(name, names[:i]) {
+			continue
+		}
+		registry, ok := e.collectors[name]
+		if !ok {
+			return nil, fmt.Errorf("collector %q is not enabled", name)
+		}
+		gatherers = append(gatherers, registry)
+	}
+
+	var g prometheus.Gatherer = gatherers
+	if e.cfg == nil {
+		return g, nil
+	}
+	if e.cfg.AllowMetrics.Regexp != nil || e.cfg.DenyMetrics.Regexp != nil || len(e.cfg.MetricRelabelConfigs) > 0 {
+		g = &relabelGatherer{g, e.cfg.AllowMetrics, e.cfg.DenyMetrics, e.cfg.MetricRelabelConfigs}
+	}
+	if e.limiter != nil {
+		g = &limitGatherer{g, e.limiter}
+	}
+	return g, nil
+}
+
+// clientFactory loads the certificates and the authentication provider of
+// the configuration and returns a function creating clients for a URL.
+func (cfg *config) clientFactory() (func(url string) *httpClient, error) {
+	tlsConfig, err := newClientTLSConfig(cfg.TLS.TrustedCerts, cfg.TLS.ClientCert, cfg.TLS.ClientKey, cfg.TLS.SkipSSLVerify)
+	if err != nil {
+		return nil, err
+	}
+	// The provider is shared by the clients, so that they share tokens.
+	auth, err := cfg.authProvider(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(url string) *httpClient {
+		client := mkHTTPClient(url, cfg.Timeout, auth, tlsConfig)
+		client.timeouts = cfg.EndpointTimeouts
+		return client
+	}, nil
+}
+
+// newCollectors creates the collectors enabled in the configuration for all
+// targets, and returns a gatherer of each collector by name. The returned
+// function stops their background work. It fails if the metrics of the
+// collectors of a target conflict.
+//
+// When both masters and agents are given, the metrics are labeled with the
+// mesos_role of their target, and when several targets of a role are given,
+// with the mesos_target URL, as their names would otherwise collide.
+func newCollectors(cfg *config, newClient func(url string) *httpClient) (map[string]prometheus.Gatherer, func(), error) {
+	gatherers := map[string]mergedGatherers{}
+	ctx, stop := context.WithCancel(context.Background())
+
+	contentType, _ := cfg.operatorContentType()
+	for _, master := range []bool{true, false} {
+		role, urls := "agent", cfg.Slave
+		if master {
+			role, urls = "master", cfg.Master
+		}
+
+		for _, url := range urls {
+			labels := prometheus.Labels{}
+			if len(cfg.Master) > 0 && len(cfg.Slave) > 0 {
+				labels["mesos_role"] = role
+			}
+			if len(urls) > 1 {
+				labels["mesos_target"] = url
+			}
+
+			// The collectors of a target are registered together to detect
+			// conflicting metrics.
+			registry := prometheus.NewRegistry()
+			for _, name := range collectorNames() {
+				f := collectorFactories[name]
+				if f.master != master || !cfg.Collectors[name] {
+					continue
+				}
+
+				client := newClient(url)
+				if stringInSlice(name, cfg.OperatorAPI.Collectors) {
+					client.operatorAPI = contentType
+				}
+				c := f.new(ctx, cfg, client)
+				if err := registry.Register(c); err != nil {
+					stop()
+					return nil, nil, fmt.Errorf("error registering collector %s of %s: %v", name, url, err)
+				}
+
+				collectorRegistry := prometheus.NewRegistry()
+				if err := collectorRegistry.Register(c); err != nil {
+					stop()
+					return nil, nil, fmt.Errorf("error registering collector %s of %s: %v", name, url, err)
+				}
+				var g prometheus.Gatherer = collectorRegistry
+				if len(labels) > 0 {
+					g = &labeledGatherer{g, labels}
+				}
+				gatherers[name] = append(gatherers[name], g)
+			}
+		}
+	}
+
+	collectors := map[string]prometheus.Gatherer{}
+	for name, g := range gatherers {
+		collectors[name] = g
+	}
+	return collectors, stop, nil
+}
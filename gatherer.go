@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labeledGatherer adds constant labels to all metrics of a gatherer, to
+// distinguish the metrics of targets.
+type labeledGatherer struct {
+	prometheus.Gatherer
+	labels prometheus.Labels
+}
+
+func (g *labeledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for name, value := range g.labels {
+				m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+			}
+			sort.Sort(prometheus.LabelPairSorter(m.Label))
+		}
+	}
+	return mfs, err
+}
+
+// mergedGatherers merges the metric families of gatherers. Unlike
+// prometheus.Gatherers, it does not require the metrics of a family to have
+// the same labels, as masters and agents export some metrics with the same
+// name but different labels. Families with the same name must have the same
+// type, and the help of the first family is kept. Like prometheus.Gatherers,
+// it drops metrics with the same name and label values as a previous one.
+type mergedGatherers []prometheus.Gatherer
+
+func (gs mergedGatherers) Gather() ([]*dto.MetricFamily, error) {
+	var (
+		families = map[string]*dto.MetricFamily{}
+		names    []string
+		errs     prometheus.MultiError
+		series   = map[string]bool{}
+	)
+	for _, g := range gs {
+		mfs, err := g.Gather()
+		if multiErr, ok := err.(prometheus.MultiError); ok {
+			errs = append(errs, multiErr...)
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, mf := range mfs {
+			existing, ok := families[mf.GetName()]
+			if ok && existing.GetType() != mf.GetType() {
+				errs = append(errs, fmt.Errorf("gathered metric family %s has type %s but should have %s",
+					mf.GetName(), mf.GetType(), existing.GetType()))
+				continue
+			}
+
+			metrics := mf.Metric[:0]
+			for _, m := range mf.Metric {
+				key := mf.GetName() + "\xff" + seriesKey(m)
+				if series[key] {
+					errs = append(errs, fmt.Errorf("collected metric %s %s was collected before with the same name and label values",
+						mf.GetName(), m))
+					continue
+				}
+				series[key] = true
+				metrics = append(metrics, m)
+			}
+			mf.Metric = metrics
+
+			if !ok {
+				families[mf.GetName()] = mf
+				names = append(names, mf.GetName())
+				continue
+			}
+			existing.Metric = append(existing.Metric, mf.Metric...)
+		}
+	}
+
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		result = append(result, families[name])
+	}
+	return result, errs.MaybeUnwrap()
+}
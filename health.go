@@ -0,0 +1,107 @@
+// Readiness of the exporter, from the outcome of its fetches of the Mesos
+// endpoints and of the strict mode logins. The exporter is ready unless the
+// last fetch of an endpoint failed and its last successful fetch, or the start
+// of the exporter if there was none, is older than a grace period, e.g. due to
+// bad credentials or a dead target. Endpoints are only known once fetched. The
+// outcomes are kept across reloads for the targets still configured.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchHealth records the outcome of the last fetch of each endpoint.
+type fetchHealth struct {
+	now func() time.Time
+	// start is the time the fetches are measured from.
+	start time.Time
+
+	mu      sync.Mutex
+	fetches map[string]*fetchStatus
+}
+
+type fetchStatus struct {
+	// success is the time of the last successful fetch, zero if none.
+	success time.Time
+	// err is the error of the last fetch, nil if it succeeded.
+	err error
+}
+
+func newFetchHealth() *fetchHealth {
+	return &fetchHealth{now: time.Now, start: time.Now(), fetches: map[string]*fetchStatus{}}
+}
+
+// record records the outcome of a fetch of an endpoint URL, ignoring its
+// query. Nothing is recorded by a nil fetchHealth.
+func (h *fetchHealth) record(url string, err error) {
+	if h == nil {
+		return
+	}
+	url = strings.SplitN(url, "?", 2)[0]
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status, ok := h.fetches[url]
+	if !ok {
+		status = &fetchStatus{}
+		h.fetches[url] = status
+	}
+	if err == nil {
+		status.success = now
+	}
+	status.err = err
+}
+
+// retain forgets the endpoints of targets other than the given ones, e.g.
+// those removed by a reload.
+func (h *fetchHealth) retain(targets []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for url := range h.fetches {
+		retained := false
+		for _, target := range targets {
+			retained = retained || strings.HasPrefix(url, strings.TrimSuffix(target, "/")+"/")
+		}
+		if !retained {
+			delete(h.fetches, url)
+		}
+	}
+}
+
+// failing returns the errors of the endpoints whose last fetch failed and
+// which have not been fetched successfully for the grace period, by URL.
+func (h *fetchHealth) failing(grace time.Duration) map[string]error {
+	now := h.now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	failing := map[string]error{}
+	for url, status := range h.fetches {
+		since := status.success
+		if since.IsZero() {
+			since = h.start
+		}
+		if status.err != nil && now.Sub(since) >= grace {
+			failing[url] = status.err
+		}
+	}
+	return failing
+}
+
+// ready returns an error listing the failing endpoints, if any.
+func (h *fetchHealth) ready(grace time.Duration) error {
+	failing := h.failing(grace)
+	if len(failing) == 0 {
+		return nil
+	}
+	var errs []string
+	for url, err := range failing {
+		errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("failing endpoints:\n%s", strings.Join(errs, "\n"))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchHealth(t *testing.T) {
+	now := time.Unix(0, 0)
+	h := newFetchHealth()
+	h.now, h.start = func() time.Time { return now }, now
+	fetch := func(after time.Duration, ok bool) {
+		now = now.Add(after)
+		if ok {
+			h.record("http://master:5050/state?jsonp=f", nil)
+		} else {
+			h.record("http://master:5050/state", http.ErrHandlerTimeout)
+		}
+	}
+
+	// An endpoint that never succeeded fails once the grace period has
+	// passed since the start.
+	fetch(30*time.Second, false)
+	if err := h.ready(time.Minute); err != nil {
+		t.Errorf("not ready within grace period: %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if err := h.ready(time.Minute); err == nil {
+		t.Error("ready although never fetched successfully since the start")
+	}
+
+	fetch(time.Second, true)
+	if err := h.ready(0); err != nil {
+		t.Errorf("not ready after successful fetch: %v", err)
+	}
+	// A single failed fetch after the grace period since the last success
+	// is enough.
+	fetch(time.Hour, false)
+	if err := h.ready(time.Minute); err == nil {
+		t.Error("ready although failing for longer than the grace period")
+	}
+	if failing := h.failing(time.Minute); failing["http://master:5050/state"] == nil {
+		t.Errorf("got failing endpoints %v", failing)
+	}
+
+	h.retain([]string{"http://master:5050/"})
+	if failing := h.failing(time.Minute); len(failing) != 1 {
+		t.Errorf("got failing endpoints %v after retaining the target", failing)
+	}
+	h.retain([]string{"http://master:50"})
+	if failing := h.failing(time.Minute); len(failing) != 0 {
+		t.Errorf("got failing endpoints %v after removing the target", failing)
+	}
+}
+
+func TestExporterReady(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	cfg := &config{Slave: targets{srv.URL}, Timeout: time.Second, Collectors: map[string]bool{"agent_snapshot": true}}
+	e := newExporter(func() (*config, error) { return cfg, cfg.validate() })
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ready(); err != nil {
+		t.Errorf("not ready before fetching: %v", err)
+	}
+	e.Gather()
+	if err := e.ready(); err == nil {
+		t.Error("ready although the endpoint is failing")
+	}
+
+	// Reloads keep the failures of the targets still configured.
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ready(); err == nil {
+		t.Error("ready although the endpoint is failing after reload")
+	}
+	cfg = &config{Slave: targets{"http://agent:5051"}, Timeout: time.Second}
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ready(); err != nil {
+		t.Errorf("not ready after removing the failing target: %v", err)
+	}
+}
+
+func TestHTTPClientErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"title": "Unauthorized"}`))
+	}))
+	defer srv.Close()
+
+	// Error responses are neither decoded nor ready, even if they are JSON.
+	client := &httpClient{url: srv.URL, health: newFetchHealth()}
+	var target map[string]interface{}
+	if client.fetchAndDecode("/state", &target) || target != nil {
+		t.Errorf("decoded error response %v", target)
+	}
+	if failing := client.health.failing(0); failing[srv.URL+"/state"] == nil {
+		t.Errorf("got failing endpoints %v, want %s/state", failing, srv.URL)
+	}
+}
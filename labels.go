@@ -0,0 +1,233 @@
+// Selection of the task labels and agent attributes exported as metric labels.
+//
+// A selection is a list of entries, each of which is either
+//   - a key, exporting the label or attribute with that key,
+//   - a source=target pair, exporting the key source as label target,
+//   - a glob pattern with * and ?, or
+//   - a /regex/ matching the whole key.
+//
+// Keys are compared as given and after normalisation into label names, and
+// patterns are matched against the original keys. Selected keys are exported with an
+// optional prefix, except for renamed ones.
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var labelCollisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "mesos",
+	Subsystem: "exporter",
+	Name:      "label_collisions_total",
+	Help:      "Total number of task labels or agent attributes not exported, as their label name collided with another label after normalisation.",
+}, []string{"metric", "label"})
+
+// targetLabels are added to all metrics when several targets are monitored.
+var targetLabels = []string{"mesos_role", "mesos_target"}
+
+// labelSelector selects the task labels or agent attributes exported as
+// labels of a metric.
+type labelSelector struct {
+	prefix string
+	// keys and names map the keys selected explicitly, as given and
+	// normalised, to their label names, which are always exported.
+	keys     map[string]string
+	names    map[string]string
+	static   []string
+	patterns []*regexp.Regexp
+	// reserved are the label names the metric already has.
+	reserved []string
+}
+
+// newLabelSelector returns a selector of the entries, exporting the selected
+// keys with the prefix. The label names of the explicitly selected keys must
+// not collide with each other or with reserved.
+func newLabelSelector(entries []string, prefix string, reserved []string) (*labelSelector, error) {
+	s := &labelSelector{
+		prefix:   prefix,
+		keys:     map[string]string{},
+		names:    map[string]string{},
+		reserved: append(reserved[:len(reserved):len(reserved)], targetLabels...),
+	}
+	if prefix != "" && !labelNameRE.MatchString(prefix) {
+		return nil, fmt.Errorf("invalid label prefix %q", prefix)
+	}
+
+	for _, entry := range entries {
+		switch {
+		case len(entry) > 1 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+			re, err := regexp.Compile("^(?:" + entry[1:len(entry)-1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid label pattern %s: %v", entry, err)
+			}
+			s.patterns = append(s.patterns, re)
+		case strings.ContainsAny(entry, "*?"):
+			s.patterns = append(s.patterns, globRegexp(entry))
+		default:
+			key, name := entry, prefix+normaliseLabel(entry)
+			if kv := strings.SplitN(entry, "=", 2); len(kv) == 2 {
+				key, name = kv[0], kv[1]
+				if !labelNameRE.MatchString(name) {
+					return nil, fmt.Errorf("invalid label name %q for %s", name, kv[0])
+				}
+			}
+			if stringInSlice(name, s.reserved) || stringInSlice(name, s.static) {
+				return nil, fmt.Errorf("label %q of %s collides with another label", name, entry)
+			}
+			s.keys[key] = name
+			s.names[normaliseLabel(key)] = name
+			s.static = append(s.static, name)
+		}
+	}
+	return s, nil
+}
+
+// globRegexp converts a glob pattern into a regular expression.
+func globRegexp(glob string) *regexp.Regexp {
+	var expr []string
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr = append(expr, ".*")
+		case '?':
+			expr = append(expr, ".")
+		default:
+			expr = append(expr, regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile("^" + strings.Join(expr, "") + "$")
+}
+
+// empty tells whether nothing is selected.
+func (s *labelSelector) empty() bool {
+	return s == nil || len(s.keys) == 0 && len(s.patterns) == 0
+}
+
+// selectLabels returns the labels selected from the key-value pairs for a
+// series of metric. Keys selected explicitly as given take precedence over
+// those matching after normalisation, which take precedence over patterns.
+// Otherwise, of keys colliding after normalisation, the first in sort order
+// is exported and the collision counted.
+func (s *labelSelector) selectLabels(metric string, pairs map[string]string) prometheus.Labels {
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labels := prometheus.Labels{}
+	sources := map[string]string{}
+	add := func(key, name string) {
+		if _, exists := labels[name]; exists || stringInSlice(name, s.reserved) {
+			log.WithFields(log.Fields{
+				"metric": metric,
+				"key":    key,
+				"label":  name,
+				"source": sources[name],
+			}).Debug("label collides with another label after normalisation")
+			labelCollisions.WithLabelValues(metric, name).Inc()
+			return
+		}
+		labels[name] = pairs[key]
+		sources[name] = key
+	}
+
+	var normalised, unmatched []string
+	for _, key := range keys {
+		if name, ok := s.keys[key]; ok {
+			add(key, name)
+		} else {
+			normalised = append(normalised, key)
+		}
+	}
+	for _, key := range normalised {
+		if name, ok := s.names[normaliseLabel(key)]; ok {
+			add(key, name)
+		} else {
+			unmatched = append(unmatched, key)
+		}
+	}
+	for _, key := range unmatched {
+		for _, re := range s.patterns {
+			if re.MatchString(key) {
+				add(key, s.prefix+normaliseLabel(key))
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// selectedLabelsCounter is a counter vector whose label names are its default
+// labels followed by the labels selected for the series of the current
+// scrape. The explicitly selected labels are always present, and selected
+// labels missing from a series are empty. Series with the same label values as
+// a previous one are dropped, e.g. those of exploded attributes which are not
+// selected.
+type selectedLabelsCounter struct {
+	name, help string
+	defaults   []string
+	selector   *labelSelector
+	series     []selectedSeries
+}
+
+type selectedSeries struct {
+	value    float64
+	defaults []string
+	selected prometheus.Labels
+}
+
+func newSelectedLabelsCounter(subsystem, name, help string, selector *labelSelector, defaults ...string) *selectedLabelsCounter {
+	if selector == nil {
+		selector = &labelSelector{}
+	}
+	return &selectedLabelsCounter{
+		name:     prometheus.BuildFQName("mesos", subsystem, name),
+		help:     help,
+		defaults: defaults,
+		selector: selector,
+	}
+}
+
+// Set adds a series with the values of the default labels and the labels
+// selected from the key-value pairs.
+func (c *selectedLabelsCounter) Set(value float64, pairs map[string]string, defaults ...string) {
+	c.series = append(c.series, selectedSeries{value, defaults, c.selector.selectLabels(c.name, pairs)})
+}
+
+func (c *selectedLabelsCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- prometheus.NewDesc(c.name, c.help, append(c.defaults[:len(c.defaults):len(c.defaults)], c.selector.static...), nil)
+}
+
+func (c *selectedLabelsCounter) Collect(ch chan<- prometheus.Metric) {
+	names := append([]string{}, c.selector.static...)
+	var dynamic []string
+	for _, s := range c.series {
+		for name := range s.selected {
+			if !stringInSlice(name, names) && !stringInSlice(name, dynamic) {
+				dynamic = append(dynamic, name)
+			}
+		}
+	}
+	sort.Strings(dynamic)
+	names = append(names, dynamic...)
+
+	desc := prometheus.NewDesc(c.name, c.help, append(c.defaults[:len(c.defaults):len(c.defaults)], names...), nil)
+	seen := map[string]bool{}
+	for _, s := range c.series {
+		values := append(s.defaults[:len(s.defaults):len(s.defaults)], getLabelValuesFromMap(s.selected, names)...)
+		key := strings.Join(values, "\xff")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, s.value, values...)
+	}
+	c.series = nil
+}
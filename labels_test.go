@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLabelSelector(t *testing.T) {
+	pairs := map[string]string{
+		"owner":              "web",
+		"com.example/team":   "infra",
+		"com.example/tier":   "backend",
+		"HAPROXY_0_VHOST":    "example.com",
+		"team-name":          "a",
+		"team.name":          "b",
+		"task_id":            "shadow",
+		"DCOS_PACKAGE_NAME":  "kafka",
+		"DCOS_PACKAGE_OWNER": "x",
+	}
+
+	for _, tt := range []struct {
+		entries []string
+		prefix  string
+		want    prometheus.Labels
+	}{
+		{nil, "", prometheus.Labels{}},
+		{[]string{"owner", "missing"}, "", prometheus.Labels{"owner": "web"}},
+		{[]string{"HAPROXY_0_VHOST=vhost", "owner"}, "task_label_", prometheus.Labels{"vhost": "example.com", "task_label_owner": "web"}},
+		{[]string{"com.example/*"}, "", prometheus.Labels{"com_example_team": "infra", "com_example_tier": "backend"}},
+		{[]string{"/DCOS_PACKAGE_(NAME|VERSION)/"}, "", prometheus.Labels{"DCOS_PACKAGE_NAME": "kafka"}},
+		// Collisions after normalisation keep the first key, and reserved
+		// labels are never overwritten.
+		{[]string{"team?name"}, "", prometheus.Labels{"team_name": "a"}},
+		{[]string{"task_*"}, "", prometheus.Labels{}},
+		{[]string{"task_*"}, "label_", prometheus.Labels{"label_task_id": "shadow"}},
+		// Explicit selections take precedence over patterns.
+		{[]string{"*", "team.name=team_name"}, "", prometheus.Labels{
+			"owner": "web", "com_example_team": "infra", "com_example_tier": "backend", "HAPROXY_0_VHOST": "example.com",
+			"team_name": "b", "DCOS_PACKAGE_NAME": "kafka", "DCOS_PACKAGE_OWNER": "x",
+		}},
+	} {
+		s, err := newLabelSelector(tt.entries, tt.prefix, defaultTaskLabels)
+		if err != nil {
+			t.Errorf("%v: %v", tt.entries, err)
+			continue
+		}
+		if got := s.selectLabels("mesos_slave_task_labels", pairs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.entries, got, tt.want)
+		}
+	}
+
+	for _, entries := range [][]string{
+		{"task_id"},
+		{"owner=mesos_role"},
+		{"team.name", "team-name"},
+		{"owner=1owner"},
+		{"/(/"},
+	} {
+		if _, err := newLabelSelector(entries, "", defaultTaskLabels); err == nil {
+			t.Errorf("%v: expected error", entries)
+		}
+	}
+}
+
+func TestSelectedLabelsCounter(t *testing.T) {
+	s, err := newLabelSelector([]string{"rack", "zone_*"}, "", []string{"slave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newSelectedLabelsCounter("slave", "attributes", "Attributes assigned to slaves", s, "slave")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	c.Set(1, map[string]string{"rack": "r1", "zone_a": "1"}, "agent1")
+	c.Set(1, map[string]string{"zone_b": "2"}, "agent2")
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range mfs[0].Metric {
+		got = append(got, labelString(m.GetLabel()))
+	}
+	want := []string{"rack=,slave=agent2,zone_a=,zone_b=2", "rack=r1,slave=agent1,zone_a=1,zone_b="}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Exploded attributes which are not selected give a single series.
+	attributes := map[string]json.RawMessage{"rack": json.RawMessage(`"r1"`), "zones": json.RawMessage(`"{a,b}"`)}
+	for _, pairs := range attributeSeries(attributes, []string{"zones"}) {
+		c.Set(1, pairs, "agent1")
+	}
+	mfs, err = registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(mfs[0].Metric); got != 1 {
+		t.Errorf("got %d series of an exploded attribute which is not selected, want 1", got)
+	}
+}
+
+func labelString(pairs []*dto.LabelPair) string {
+	var s []string
+	for _, l := range pairs {
+		s = append(s, l.GetName()+"="+l.GetValue())
+	}
+	return strings.Join(s, ",")
+}
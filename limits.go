@@ -0,0 +1,181 @@
+// Limits on the number of series of metric families, to bound the cardinality
+// of per-task and per-framework metrics under workload churn.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// otherLabelValue is the label value of the series aggregating the series
+// exceeding a limit.
+const otherLabelValue = "__other__"
+
+var seriesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "mesos",
+	Subsystem: "exporter",
+	Name:      "series_dropped_total",
+	Help:      "Total number of series exceeding the series limit of their metric, which were dropped or aggregated, or duplicating another series after relabeling.",
+}, []string{"metric"})
+
+// seriesLimiter limits the number of series of metric families. The series
+// exceeding the limit are dropped, or aggregated into a single series
+// labeled __other__.
+type seriesLimiter struct {
+	limits    map[string]int
+	aggregate bool
+
+	mu sync.Mutex
+	// exported are the series exported by the last scrape by metric name,
+	// which are preferred over new series so that series do not flap.
+	exported map[string]map[string]bool
+}
+
+// newSeriesLimiter returns a limiter of the series limits of the
+// configuration, or nil if there are none.
+func newSeriesLimiter(cfg *config) *seriesLimiter {
+	if len(cfg.SeriesLimits) == 0 {
+		return nil
+	}
+	return &seriesLimiter{
+		limits:    cfg.SeriesLimits,
+		aggregate: cfg.SeriesLimitOverflow != "drop",
+		exported:  map[string]map[string]bool{},
+	}
+}
+
+// parseSeriesLimits parses a comma-separated list of metric=limit pairs.
+func parseSeriesLimits(s string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, pair := range csvInputToList(s) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid series limit %q, must be metric=limit", pair)
+		}
+		limit, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid series limit %q: %v", pair, err)
+		}
+		limits[kv[0]] = limit
+	}
+	return limits, nil
+}
+
+// limit applies the limits to the metric families in place.
+func (l *seriesLimiter) limit(mfs []*dto.MetricFamily) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, mf := range mfs {
+		limit, ok := l.limits[mf.GetName()]
+		if !ok {
+			continue
+		}
+
+		exported := l.exported[mf.GetName()]
+		keys := make(map[*dto.Metric]string, len(mf.Metric))
+		for _, m := range mf.Metric {
+			keys[m] = seriesKey(m)
+		}
+		if len(mf.Metric) > limit {
+			sort.SliceStable(mf.Metric, func(i, j int) bool {
+				return exported[keys[mf.Metric[i]]] && !exported[keys[mf.Metric[j]]]
+			})
+		}
+
+		l.exported[mf.GetName()] = map[string]bool{}
+		for i, m := range mf.Metric {
+			if i < limit {
+				l.exported[mf.GetName()][keys[m]] = true
+			}
+		}
+		if len(mf.Metric) <= limit {
+			continue
+		}
+
+		excess := mf.Metric[limit:]
+		seriesDropped.WithLabelValues(mf.GetName()).Add(float64(len(excess)))
+		mf.Metric = mf.Metric[:limit]
+		if other := aggregateSeries(mf.GetType(), excess); l.aggregate && other != nil {
+			mf.Metric = append(mf.Metric, other)
+		}
+	}
+}
+
+// aggregateSeries sums series into a single series. Labels with the same
+// value in all series keep it, the others are set to __other__. Summaries and
+// histograms are not aggregated, in which case nil is returned.
+func aggregateSeries(typ dto.MetricType, series []*dto.Metric) *dto.Metric {
+	var sum float64
+	for _, m := range series {
+		switch typ {
+		case dto.MetricType_COUNTER:
+			sum += m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			sum += m.GetGauge().GetValue()
+		case dto.MetricType_UNTYPED:
+			sum += m.GetUntyped().GetValue()
+		default:
+			return nil
+		}
+	}
+
+	other := &dto.Metric{}
+	for _, l := range series[0].Label {
+		value := l.GetValue()
+		for _, m := range series[1:] {
+			if labelValue(m, l.GetName()) != value {
+				value = otherLabelValue
+				break
+			}
+		}
+		other.Label = append(other.Label, &dto.LabelPair{Name: l.Name, Value: proto.String(value)})
+	}
+
+	switch typ {
+	case dto.MetricType_COUNTER:
+		other.Counter = &dto.Counter{Value: proto.Float64(sum)}
+	case dto.MetricType_GAUGE:
+		other.Gauge = &dto.Gauge{Value: proto.Float64(sum)}
+	case dto.MetricType_UNTYPED:
+		other.Untyped = &dto.Untyped{Value: proto.Float64(sum)}
+	}
+	return other
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// seriesKey identifies a series of a metric family by its labels.
+func seriesKey(m *dto.Metric) string {
+	var key []string
+	for _, l := range m.Label {
+		key = append(key, l.GetName()+"="+l.GetValue())
+	}
+	return strings.Join(key, "\xff")
+}
+
+// limitGatherer applies the series limits of a limiter to a gatherer.
+type limitGatherer struct {
+	prometheus.Gatherer
+	limiter *seriesLimiter
+}
+
+func (g *limitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	g.limiter.limit(mfs)
+	return mfs, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSeriesLimiter(t *testing.T) {
+	gather := func(tasks ...string) []*dto.MetricFamily {
+		registry := prometheus.NewRegistry()
+		g := gauge("slave", "task_labels", "Task labels", "task_id", "owner")
+		for _, task := range tasks {
+			g.WithLabelValues(task, "web").Set(1)
+		}
+		registry.MustRegister(g)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mfs
+	}
+	series := func(mfs []*dto.MetricFamily) map[string]float64 {
+		got := map[string]float64{}
+		for _, m := range mfs[0].Metric {
+			got[labelKey(m.GetLabel(), []string{"task_id", "owner"})] = m.GetGauge().GetValue()
+		}
+		return got
+	}
+	dropped := func() float64 {
+		var m dto.Metric
+		seriesDropped.WithLabelValues("mesos_slave_task_labels").Write(&m)
+		return m.GetCounter().GetValue()
+	}
+
+	l := newSeriesLimiter(&config{SeriesLimits: map[string]int{"mesos_slave_task_labels": 2}})
+	before := dropped()
+
+	mfs := gather("c", "d", "e", "f")
+	l.limit(mfs)
+	if want := map[string]float64{"c/web": 1, "d/web": 1, "__other__/web": 2}; !reflect.DeepEqual(series(mfs), want) {
+		t.Errorf("got %v, want %v", series(mfs), want)
+	}
+
+	// Series exported before are kept over new series sorting first.
+	mfs = gather("a", "b", "d", "e")
+	l.limit(mfs)
+	if want := map[string]float64{"d/web": 1, "a/web": 1, "__other__/web": 2}; !reflect.DeepEqual(series(mfs), want) {
+		t.Errorf("got %v, want %v", series(mfs), want)
+	}
+	if got := dropped() - before; got != 4 {
+		t.Errorf("got %v dropped series, want 4", got)
+	}
+
+	l = newSeriesLimiter(&config{SeriesLimits: map[string]int{"mesos_slave_task_labels": 2}, SeriesLimitOverflow: "drop"})
+	mfs = gather("a", "b", "c")
+	l.limit(mfs)
+	if want := map[string]float64{"a/web": 1, "b/web": 1}; !reflect.DeepEqual(series(mfs), want) {
+		t.Errorf("got %v, want %v", series(mfs), want)
+	}
+}
+
+func TestParseSeriesLimits(t *testing.T) {
+	limits, err := parseSeriesLimits("mesos_slave_task_labels=100, mesos_master_frameworks=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"mesos_slave_task_labels": 100, "mesos_master_frameworks": 10}; !reflect.DeepEqual(limits, want) {
+		t.Errorf("got %v, want %v", limits, want)
+	}
+	for _, s := range []string{"mesos_slave_task_labels", "mesos_slave_task_labels=many"} {
+		if _, err := parseSeriesLimits(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
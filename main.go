@@ -10,10 +10,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
@@ -32,52 +35,41 @@ func init() {
 	log.SetLevel(log.ErrorLevel)
 
 	prometheus.MustRegister(errorCounter)
+	prometheus.MustRegister(configLastReloadSuccessful)
+	prometheus.MustRegister(configLastReloadSuccessTimestamp)
+	prometheus.MustRegister(seriesDropped)
+	prometheus.MustRegister(labelCollisions)
+	prometheus.MustRegister(certificateExpiry)
+	prometheus.MustRegister(authTokenExpiry)
+	prometheus.MustRegister(authLogins)
+	prometheus.MustRegister(authLoginErrors)
 }
 
-func getX509CertPool(pemFiles []string) *x509.CertPool {
+func getX509CertPool(pemFiles []string) (*x509.CertPool, error) {
 	pool := x509.NewCertPool()
 	for _, f := range pemFiles {
 		content, err := ioutil.ReadFile(f)
 		if err != nil {
-			log.WithField("error", err).Fatal("x509 certificate pool error")
+			return nil, fmt.Errorf("x509 certificate pool error: %v", err)
 		}
 		ok := pool.AppendCertsFromPEM(content)
 		if !ok {
-			log.WithField("file", f).Fatal("Error parsing .pem file")
+			return nil, fmt.Errorf("error parsing .pem file %s", f)
 		}
 	}
-	return pool
+	return pool, nil
 }
 
-func getX509ClientCertificates(certFile, keyFile string) []tls.Certificate {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"certFile": certFile,
-			"keyFile":  keyFile,
-			"error":    err,
-		}).Fatal("Error loading TLS client certificates")
-	}
-	return []tls.Certificate{cert}
-}
-
-func mkHTTPClient(url string, timeout time.Duration, auth authInfo, certPool *x509.CertPool, certs []tls.Certificate) *httpClient {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			Certificates:       certs,
-			RootCAs:            certPool,
-			InsecureSkipVerify: auth.skipSSLVerify,
-		},
-	}
+func mkHTTPClient(url string, timeout time.Duration, auth authProvider, tlsConfig *tls.Config) *httpClient {
+	transport := newClientTransport(tlsConfig, timeout)
 
 	// HTTP Redirects are authenticated by Go (>=1.8), when redirecting to an identical domain or a subdomain.
 	// -> Hijack redirect authentication, since hostnames rarely follow this logic.
 	var redirectFunc func(req *http.Request, via []*http.Request) error
-	if auth.username != "" && auth.password != "" {
+	if auth != nil {
 		// Auth information is only available in the current context -> use lambda function
 		redirectFunc = func(req *http.Request, via []*http.Request) error {
-			req.SetBasicAuth(auth.username, auth.password)
-			return nil
+			return auth.authenticate(req)
 		}
 	}
 
@@ -86,48 +78,69 @@ func mkHTTPClient(url string, timeout time.Duration, auth authInfo, certPool *x5
 		url,
 		auth,
 		"",
+		"",
+		nil,
+		nil,
 	}
+	client.userAgent = userAgent()
 
-	if auth.strictMode {
-		client.auth.signingKey = parsePrivateKey(client)
-	}
+	return client
+}
 
+func userAgent() string {
 	if version.Revision != "" {
-		client.userAgent = fmt.Sprintf("mesos_exporter/%s (%s)", version.Version, version.Revision)
-	} else {
-		client.userAgent = fmt.Sprintf("mesos_exporter/%s", version.Version)
+		return fmt.Sprintf("mesos_exporter/%s (%s)", version.Version, version.Revision)
 	}
-
-	return client
+	return fmt.Sprintf("mesos_exporter/%s", version.Version)
 }
 
-func parsePrivateKey(httpClient *httpClient) []byte {
-	if _, err := os.Stat(httpClient.auth.privateKey); os.IsNotExist(err) {
-		buffer := bytes.NewBuffer([]byte(httpClient.auth.privateKey))
+// parsePrivateKey returns a function returning the private key of the strict
+// mode authentication, which is either the content of a secret in JSON,
+// which is returned too, or a file that is reloaded when it changes.
+func parsePrivateKey(privateKey string) (func() []byte, *mesosSecret) {
+	if _, err := os.Stat(privateKey); os.IsNotExist(err) {
+		buffer := bytes.NewBuffer([]byte(privateKey))
 		var key mesosSecret
 		if err := json.NewDecoder(buffer).Decode(&key); err != nil {
-			log.WithFields(log.Fields{
-				"key":   key,
-				"error": err,
-			}).Error("Error decoding prviate key")
+			// The error, unlike the key, does not contain the secret.
+			log.WithField("error", err).Error("Error decoding private key")
 			errorCounter.Inc()
-			return []byte{}
+			return func() []byte { return []byte{} }, nil
 		}
-		httpClient.auth.username = key.UID
-		httpClient.auth.loginURL = key.LoginEndpoint
-		return []byte(key.PrivateKey)
+		return func() []byte { return []byte(key.PrivateKey) }, &key
 	}
-	absPath, _ := filepath.Abs(httpClient.auth.privateKey)
-	key, err := ioutil.ReadFile(absPath)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"absPath": absPath,
-			"error":   err,
-		}).Error("Error reading prviate key")
-		errorCounter.Inc()
-		return []byte{}
+	absPath, _ := filepath.Abs(privateKey)
+	// A key that cannot be read yet is retried whenever it is used.
+	key := &watchedFiles{paths: []string{absPath}, parse: parseSigningKey}
+	secret, _ := key.get().(*mesosSecret)
+	return privateKeyFunc(key), secret
+}
+
+// parseSigningKey parses a file with a PEM encoded private key, or a secret
+// in JSON containing one.
+func parseSigningKey(contents [][]byte) (interface{}, error) {
+	key := &mesosSecret{PrivateKey: string(contents[0])}
+	if content := bytes.TrimSpace(contents[0]); len(content) > 0 && content[0] == '{' {
+		key = &mesosSecret{}
+		if err := json.Unmarshal(content, key); err != nil {
+			return nil, fmt.Errorf("error decoding secret: %v", err)
+		}
+	}
+	if _, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key.PrivateKey)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// privateKeyFunc returns a function returning the current private key of a
+// file parsed by parseSigningKey.
+func privateKeyFunc(key *watchedFiles) func() []byte {
+	return func() []byte {
+		if secret, ok := key.get().(*mesosSecret); ok {
+			return []byte(secret.PrivateKey)
+		}
+		return nil
 	}
-	return key
 }
 
 func csvInputToList(input string) []string {
@@ -143,23 +156,57 @@ func csvInputToList(input string) []string {
 func main() {
 	fs := flag.NewFlagSet("mesos-exporter", flag.ExitOnError)
 	addr := fs.String("addr", ":9105", "Address to listen on")
-	masterURL := fs.String("master", "", "Expose metrics from master running on this URL")
-	slaveURL := fs.String("slave", "", "Expose metrics from slave running on this URL")
+	masterURL := fs.String("master", "", "Expose metrics from masters running on this comma-separated list of URLs")
+	slaveURL := fs.String("slave", "", "Expose metrics from slaves running on this comma-separated list of URLs")
 	timeout := fs.Duration("timeout", 10*time.Second, "Master polling timeout")
-	exportedTaskLabels := fs.String("exportedTaskLabels", "", "Comma-separated list of task labels to include in the corresponding metric")
-	exportedSlaveAttributes := fs.String("exportedSlaveAttributes", "", "Comma-separated list of slave attributes to include in the corresponding metric")
+	readyGracePeriod := fs.Duration("readyGracePeriod", time.Minute, "How long the fetches of a Mesos endpoint may fail before /-/ready reports the exporter as not ready")
+	exportedTaskLabels := fs.String("exportedTaskLabels", "", "Comma-separated list of task labels to include in the corresponding metric, as keys, source=target renames, globs or /regexes/")
+	exportedSlaveAttributes := fs.String("exportedSlaveAttributes", "", "Comma-separated list of slave attributes to include in the corresponding metric, as keys, source=target renames, globs or /regexes/")
+	explodedSlaveAttributes := fs.String("explodedSlaveAttributes", "", "Comma-separated list of range and set slave attributes exported as a series per range or item")
+	exportedTaskLabelsPrefix := fs.String("exportedTaskLabelsPrefix", "", "Prefix of the label names of exported task labels, except renamed ones")
+	exportedSlaveAttributesPrefix := fs.String("exportedSlaveAttributesPrefix", "", "Prefix of the label names of exported slave attributes, except renamed ones")
 	trustedCerts := fs.String("trustedCerts", "", "Comma-separated list of certificates (.pem files) trusted for requests to Mesos endpoints")
 	clientCertFile := fs.String("clientCert", "", "Path to Mesos client TLS certificate (.pem file)")
 	clientKeyFile := fs.String("clientKey", "", "Path to Mesos client TLS key file (.pem file)")
 	strictMode := fs.Bool("strictMode", false, "Use strict mode authentication")
 	username := fs.String("username", "", "Username for authentication")
 	password := fs.String("password", "", "Password for authentication")
+	passwordFile := fs.String("passwordFile", "", "File with the password for authentication, reloaded when it changes")
 	loginURL := fs.String("loginURL", "https://leader.mesos/acs/api/v1/auth/login", "URL for strict mode authentication")
 	logLevel := fs.String("logLevel", "error", "Log level")
 	privateKey := fs.String("privateKey", "", "File path to certificate for strict mode authentication")
+	privateKeyFile := fs.String("privateKeyFile", "", "File with the private key, or a secret in JSON containing it, for strict mode authentication, reloaded when it changes")
+	bearerTokenFile := fs.String("bearerTokenFile", "", "File with a bearer token for authentication, reloaded when it changes")
+	oauth2TokenURL := fs.String("oauth2TokenURL", "", "OAuth2 token URL for client credentials authentication")
+	oauth2ClientID := fs.String("oauth2ClientID", "", "OAuth2 client ID")
+	oauth2ClientSecret := fs.String("oauth2ClientSecret", "", "OAuth2 client secret")
+	oauth2ClientSecretFile := fs.String("oauth2ClientSecretFile", "", "File with the OAuth2 client secret, reloaded when it changes")
+	oauth2Scopes := fs.String("oauth2Scopes", "", "Comma-separated list of OAuth2 scopes to request")
 	skipSSLVerify := fs.Bool("skipSSLVerify", false, "Skip SSL certificate verification")
 	vers := fs.Bool("version", false, "Show version")
-	enableMasterState := fs.Bool("enableMasterState", true, "Enable collection from the master's /state endpoint")
+	collectors := defaultCollectors()
+	registerCollectorFlags(fs, collectors)
+	fs.Var(&collectorFlag{collectors, "master_state", true}, "enableMasterState", "Enable collection from the master's /state endpoint (deprecated, use -collector.master_state)")
+	fs.Var(&collectorFlag{collectors, "master_roles", true}, "enableMasterRoles", "Enable collection from the master's /roles and /quota endpoints (deprecated, use -collector.master_roles)")
+	fs.Var(&collectorFlag{collectors, "master_maintenance", true}, "enableMasterMaintenance", "Enable collection of maintenance and agent drain state from the master (deprecated, use -collector.master_maintenance)")
+	masterStateEndpoint := fs.String("masterStateEndpoint", "", "Master endpoint polled for agent state (/state, /state-summary or /slaves), optionally with query parameters, instead of choosing the smallest endpoints automatically")
+	enableMasterEvents := fs.Bool("enableMasterEvents", false, "Serve master state metrics from the v1 Operator API SUBSCRIBE event stream instead of polling /state")
+	taskTransitionsDropLabels := fs.String("taskTransitionsDropLabels", "", "Comma-separated list of labels to drop from mesos_task_transitions_total to bound its cardinality (framework, reason)")
+	operatorAPI := fs.String("operatorAPI", "", "Comma-separated list of collectors using the v1 Operator API instead of the legacy endpoints (master_snapshot, master_state, agent_snapshot, agent_monitor)")
+	operatorAPIContentType := fs.String("operatorAPIContentType", "json", "Content type used for the v1 Operator API (json or protobuf)")
+	sdAgentPort := fs.Int("sdAgentPort", 0, "Port of the agent targets of the /sd/agents service discovery, e.g. of an exporter on every agent, instead of the agent's port")
+	sdFile := fs.String("sdFile", "", "File written with the agents of /sd/agents in the file_sd format, JSON or YAML by its extension")
+	sdFileInterval := fs.Duration("sdFileInterval", time.Minute, "Interval of the updates of -sdFile")
+	sdTasks := fs.Bool("sdTasks", false, "Serve the running tasks with discovery ports on /sd/tasks for service discovery")
+	sdRefreshInterval := fs.Duration("sdRefreshInterval", 30*time.Second, "Minimum interval between fetches of the agents and tasks from the masters for service discovery")
+	var allowMetrics, denyMetrics regex
+	fs.Var(&allowMetrics, "allowMetrics", "Regular expression of the metric names to export, matching the whole name")
+	fs.Var(&denyMetrics, "denyMetrics", "Regular expression of the metric names not to export, matching the whole name")
+	seriesLimits := fs.String("seriesLimits", "", "Comma-separated list of metric=limit pairs limiting the number of series of metrics")
+	seriesLimitOverflow := fs.String("seriesLimitOverflow", "aggregate", "What to do with series exceeding their limit: aggregate them into a series labeled __other__, or drop them")
+	configFile := fs.String("config.file", "", "YAML configuration file, overriding the flags it sets; reloaded on SIGHUP and POST /-/reload")
+	configCheck := fs.Bool("config.check", false, "Check the configuration and exit")
+	webConfigFile := fs.String("web.config.file", "", "Web configuration file enabling TLS and basic authentication of the exporter's listener; reloaded on every connection and request")
 
 	fs.Parse(os.Args[1:])
 
@@ -168,10 +215,6 @@ func main() {
 		os.Exit(0)
 	}
 
-	if *masterURL != "" && *slaveURL != "" {
-		log.Fatal("Only -master or -slave can be given at a time")
-	}
-
 	// Getting logging setup with the appropriate log level
 	logrusLogLevel, err := log.ParseLevel(*logLevel)
 	if err != nil {
@@ -182,99 +225,109 @@ func main() {
 		log.WithField("logLevel", *logLevel).Info("Changing log level")
 	}
 
-	log.Infoln("Starting mesos_exporter", version.Info())
-	log.Infoln("Build context", version.BuildContext())
-
-	prometheus.MustRegister(version.NewCollector("mesos_exporter"))
-
-	auth := authInfo{
-		strictMode:    *strictMode,
-		skipSSLVerify: *skipSSLVerify,
-		loginURL:      *loginURL,
-	}
-
-	if *strictMode && *privateKey != "" {
-		auth.privateKey = *privateKey
-	} else {
-		auth.privateKey = os.Getenv("MESOS_EXPORTER_PRIVATE_KEY")
-		log.WithField("privateKey", auth.privateKey).Debug("strict mode, no private key, pulling from the environment")
-	}
-
-	if *username != "" {
-		auth.username = *username
-	} else {
-		auth.username = os.Getenv("MESOS_EXPORTER_USERNAME")
-		log.WithField("username", auth.username).Debug("auth with no username, pulling from the environment")
-	}
-
-	if *password != "" {
-		auth.password = *password
-	} else {
-		auth.password = os.Getenv("MESOS_EXPORTER_PASSWORD")
-		// NOTE it's already in the environment, so can be easily read anyway
-		log.WithField("password", auth.password).Debug("auth with no password, pulling from the environment")
-	}
-
-	var certPool *x509.CertPool
-	if *trustedCerts != "" {
-		certPool = getX509CertPool(csvInputToList(*trustedCerts))
+	limits, err := parseSeriesLimits(*seriesLimits)
+	if err != nil {
+		log.WithField("error", err).Fatal("invalid series limits")
 	}
 
-	var certs []tls.Certificate
-	if (*clientCertFile != "" && *clientKeyFile == "") ||
-		(*clientCertFile == "" && *clientKeyFile != "") {
-		log.Fatal("Must supply both clientCert and clientKey to use TLS mutual auth")
+	flagConfig := &config{
+		Master:                        csvInputToList(*masterURL),
+		Slave:                         csvInputToList(*slaveURL),
+		Timeout:                       *timeout,
+		ReadyGracePeriod:              *readyGracePeriod,
+		Collectors:                    collectors,
+		MasterStateEndpoint:           *masterStateEndpoint,
+		MasterEvents:                  *enableMasterEvents,
+		TaskTransitionsDropLabels:     csvInputToList(*taskTransitionsDropLabels),
+		ExportedTaskLabels:            csvInputToList(*exportedTaskLabels),
+		ExportedSlaveAttributes:       csvInputToList(*exportedSlaveAttributes),
+		ExportedTaskLabelsPrefix:      *exportedTaskLabelsPrefix,
+		ExportedSlaveAttributesPrefix: *exportedSlaveAttributesPrefix,
+		ExplodedSlaveAttributes:       csvInputToList(*explodedSlaveAttributes),
+		SeriesLimits:                  limits,
+		SeriesLimitOverflow:           *seriesLimitOverflow,
 	}
-	if *clientCertFile != "" && *clientKeyFile != "" {
-		certs = getX509ClientCertificates(*clientCertFile, *clientKeyFile)
+	flagConfig.ServiceDiscovery.AgentPort = *sdAgentPort
+	flagConfig.ServiceDiscovery.Tasks = *sdTasks
+	flagConfig.ServiceDiscovery.RefreshInterval = *sdRefreshInterval
+	flagConfig.ServiceDiscovery.File = *sdFile
+	flagConfig.ServiceDiscovery.FileInterval = *sdFileInterval
+	flagConfig.AllowMetrics = allowMetrics
+	flagConfig.DenyMetrics = denyMetrics
+	flagConfig.OperatorAPI.Collectors = csvInputToList(*operatorAPI)
+	flagConfig.OperatorAPI.ContentType = *operatorAPIContentType
+	flagConfig.Auth.Username = *username
+	flagConfig.Auth.Password = secret(*password)
+	flagConfig.Auth.PasswordFile = *passwordFile
+	flagConfig.Auth.StrictMode = *strictMode
+	flagConfig.Auth.PrivateKey = secret(*privateKey)
+	flagConfig.Auth.PrivateKeyFile = *privateKeyFile
+	flagConfig.Auth.LoginURL = *loginURL
+	flagConfig.Auth.BearerTokenFile = *bearerTokenFile
+	flagConfig.Auth.OAuth2.TokenURL = *oauth2TokenURL
+	flagConfig.Auth.OAuth2.ClientID = *oauth2ClientID
+	flagConfig.Auth.OAuth2.ClientSecret = secret(*oauth2ClientSecret)
+	flagConfig.Auth.OAuth2.ClientSecretFile = *oauth2ClientSecretFile
+	flagConfig.Auth.OAuth2.Scopes = csvInputToList(*oauth2Scopes)
+	flagConfig.TLS.TrustedCerts = csvInputToList(*trustedCerts)
+	flagConfig.TLS.ClientCert = *clientCertFile
+	flagConfig.TLS.ClientKey = *clientKeyFile
+	flagConfig.TLS.SkipSSLVerify = *skipSSLVerify
+
+	load := func() (*config, error) {
+		if *configFile == "" {
+			return flagConfig, flagConfig.validate()
+		}
+		return loadConfig(*configFile, flagConfig)
 	}
 
-	slaveAttributeLabels := csvInputToList(*exportedSlaveAttributes)
-	slaveTaskLabels := csvInputToList(*exportedTaskLabels)
-
-	switch {
-	case *masterURL != "":
-		log.WithField("address", *addr).Info("Exposing master metrics")
-
-		if err := prometheus.Register(
-			newMasterCollector(mkHTTPClient(*masterURL, *timeout, auth, certPool, certs))); err != nil {
-			log.WithField("error", err).Fatal("Prometheus Register() error")
+	if *configCheck {
+		cfg, err := load()
+		if err == nil {
+			_, err = cfg.clientFactory()
 		}
-
-		if *enableMasterState {
-			if err := prometheus.Register(
-				newMasterStateCollector(mkHTTPClient(*masterURL, *timeout, auth, certPool, certs), slaveAttributeLabels)); err != nil {
-				log.WithField("error", err).Fatal("Prometheus Register() error")
+		if err == nil && *webConfigFile != "" {
+			var webCfg *webConfig
+			if webCfg, err = loadWebConfig(*webConfigFile); err == nil && webCfg.TLSServerConfig.CertFile != "" {
+				_, err = webCfg.tlsConfig()
 			}
 		}
-
-	case *slaveURL != "":
-		log.WithField("address", *addr).Info("Exposing slave metrics")
-
-		slaveCollectors := []func(*httpClient) prometheus.Collector{
-			func(c *httpClient) prometheus.Collector {
-				return newSlaveCollector(c)
-			},
-			func(c *httpClient) prometheus.Collector {
-				return newSlaveMonitorCollector(c)
-			},
-			func(c *httpClient) prometheus.Collector {
-				return newSlaveStateCollector(c, slaveTaskLabels, slaveAttributeLabels)
-			},
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Configuration is invalid:", err)
+			os.Exit(1)
 		}
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
 
-		for _, f := range slaveCollectors {
-			if err := prometheus.Register(
-				f(mkHTTPClient(*slaveURL, *timeout, auth, certPool, certs))); err != nil {
-				log.WithField("error", err).Fatal("Prometheus Register() error")
-			}
-		}
+	log.Infoln("Starting mesos_exporter", version.Info())
+	log.Infoln("Build context", version.BuildContext())
+
+	prometheus.MustRegister(version.NewCollector("mesos_exporter"))
+
+	exporter := newExporter(load)
+	if err := exporter.reload(); err != nil {
+		log.WithField("error", err).Fatal("Error loading configuration")
+	}
 
-	default:
-		log.Fatal("Either -master or -slave is required")
+	reload := func() error {
+		err := exporter.reload()
+		if err != nil {
+			log.WithField("error", err).Error("Error reloading configuration")
+		} else {
+			log.Info("Reloaded configuration")
+		}
+		return err
 	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload()
+		}
+	}()
 
-	log.Info("Listening and serving ...")
+	log.WithField("address", *addr).Info("Listening and serving ...")
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
@@ -286,8 +339,43 @@ func main() {
             </html>`))
 	})
 
-	http.Handle("/metrics", promhttp.Handler())
-	if err := http.ListenAndServe(*addr, nil); err != nil {
+	http.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Healthy\n"))
+	})
+
+	http.HandleFunc("/-/ready", func(w http.ResponseWriter, r *http.Request) {
+		if err := exporter.ready(); err != nil {
+			http.Error(w, fmt.Sprintf("Not ready: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("Ready\n"))
+	})
+
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to reload configuration: %v", err), http.StatusInternalServerError)
+		}
+	})
+
+	http.HandleFunc("/sd/", func(w http.ResponseWriter, r *http.Request) {
+		exporter.serviceDiscovery().ServeHTTP(w, r)
+	})
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// collect[] selects the collectors gathered for this scrape.
+		gatherer, err := exporter.gatherer(r.URL.Query()["collect[]"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		promhttp.HandlerFor(mergedGatherers{prometheus.DefaultGatherer, gatherer}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+	if err := listenAndServe(*addr, *webConfigFile, http.DefaultServeMux); err != nil {
 		log.WithField("error", err).Fatal("listen and serve error")
 	}
 }
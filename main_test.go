@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"reflect"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestPortRange_UnmarshalJSON(t *testing.T) {
@@ -27,3 +30,19 @@ func TestPortRange_UnmarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestCollectorsRegister(t *testing.T) {
+	cfg := &config{ExportedTaskLabels: []string{"owner"}, ExportedSlaveAttributes: []string{"rack"}}
+	for _, master := range []bool{true, false} {
+		registry := prometheus.NewRegistry()
+		for _, name := range collectorNames() {
+			f := collectorFactories[name]
+			if f.master != master {
+				continue
+			}
+			if err := registry.Register(f.new(context.Background(), cfg, &httpClient{})); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+}
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"fmt"
-	"regexp"
-
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -240,22 +237,10 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			return nil
 		},
 		counter("master", "slave_removal_events_reasons", "Total number of slave removal events by reason on this master since it booted.", "reason"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("master/slave_removals/reason_(.*?)$")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "master/slave_removals/reason_(.*?)$",
-					"metric": "master_slave_removal_events_reasons",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile slave_removal_events_reasons regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 2 {
-					continue
+				if labels, ok := masterSlaveRemovalReasonKey.match(metric); ok {
+					c.(*settableCounterVec).Set(value, labels...)
 				}
-				reason := matches[1]
-				c.(*settableCounterVec).Set(value, reason)
 			}
 			return nil
 		},
@@ -426,24 +411,10 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 		},
 
 		counter("master", "task_state_counts_by_source_reason", "Number of task states by source and reason", "state", "source", "reason"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("master/task_(.*?)/source_(.*?)/reason_(.*?)$")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "master/task_(.*?)/source_(.*?)/reason_(.*?)$",
-					"metric": "master_task_state_counts_by_source_reason",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile task_state_counts regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 4 {
-					continue
+				if labels, ok := masterTaskSourceReasonKey.match(metric); ok {
+					c.(*settableCounterVec).Set(value, labels...)
 				}
-				state := matches[1]
-				source := matches[2]
-				reason := matches[3]
-				c.(*settableCounterVec).Set(value, state, source, reason)
 			}
 			return nil
 		},
@@ -794,87 +765,37 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 			return nil
 		},
 		gauge("master", "allocator_offer_filters_active", "Number of active offer filters for all frameworks within the role", "role"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("allocator/mesos/offer_filters/roles/(.*?)/active")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "allocator/mesos/offer_filters/roles/(.*?)/active",
-					"metric": "master_allocator_offer_filters_active",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile allocator_offer_filters_active regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 2 {
-					continue
+				if labels, ok := allocatorOfferFiltersKey.match(metric); ok {
+					c.(*prometheus.GaugeVec).WithLabelValues(labels...).Set(value)
 				}
-				role := matches[1]
-				c.(*prometheus.GaugeVec).WithLabelValues(role).Set(value)
 			}
 			return nil
 		},
 
 		gauge("master", "allocator_role_quota_offered_or_allocated", "Amount of resources considered offered or allocated towards a role's quota guarantee.", "role", "resource"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("allocator/mesos/quota/roles/(.*?)/resources/(.*?)/offered_or_allocated")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "allocator/mesos/quota/roles/(.*?)/resources/(.*?)/offered_or_allocated",
-					"metric": "master_allocator_role_quota_offered_or_allocated",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile allocator_role_quota_offered_or_allocated regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 3 {
-					continue
+				if labels, ok := allocatorQuotaOfferedKey.match(metric); ok {
+					c.(*prometheus.GaugeVec).WithLabelValues(labels...).Set(value)
 				}
-				role := matches[1]
-				resource := matches[2]
-				c.(*prometheus.GaugeVec).WithLabelValues(role, resource).Set(value)
 			}
 			return nil
 		},
 
 		gauge("master", "allocator_role_shares_dominant", "Dominance factor for a role", "role"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("allocator/mesos/roles/(.*?)/shares/dominant")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "allocator/mesos/roles/(.*?)/shares/dominant",
-					"metric": "master_allocator_role_shares_dominant",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile allocator_role_shares_dominant regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 2 {
-					continue
+				if labels, ok := allocatorRoleSharesDominantKey.match(metric); ok {
+					c.(*prometheus.GaugeVec).WithLabelValues(labels...).Set(value)
 				}
-				role := matches[1]
-				c.(*prometheus.GaugeVec).WithLabelValues(role).Set(value)
 			}
 			return nil
 		},
 
 		gauge("master", "allocator_role_quota_guarantee", "Amount of resources guaranteed for a role via quota", "role", "resource"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("allocator/mesos/quota/roles/(.*?)/resources/(.*?)/guarantee")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "allocator/mesos/quota/roles/(.*?)/resources/(.*?)/guarantee",
-					"metric": "master_allocator_role_quota_guarantee",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile allocator_role_quota_guarantee regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 3 {
-					continue
+				if labels, ok := allocatorQuotaGuaranteeKey.match(metric); ok {
+					c.(*prometheus.GaugeVec).WithLabelValues(labels...).Set(value)
 				}
-				role := matches[1]
-				resource := matches[2]
-				c.(*prometheus.GaugeVec).WithLabelValues(role, resource).Set(value)
 			}
 			return nil
 		},
@@ -926,24 +847,9 @@ func newMasterCollector(httpClient *httpClient) prometheus.Collector {
 
 		// Frameworks metrics
 		counter("master", "frameworks_messages", "Messages passed around with the frameworks", "framework", "type"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("frameworks/(.*?)/messages_(.*?)$")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "frameworks/(.*?)/messages_(.*?)$",
-					"metric": "master_frameworks_messages",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile frameworks_messages regex: %s", err)
-			}
-			for metric, messageCount := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 3 {
-					continue
-				}
-				framework := matches[1]
-				messageStatus := matches[2]
-				if len(framework) > 0 && len(messageStatus) > 0 {
-					c.(*settableCounterVec).Set(messageCount, framework, messageStatus)
+			for metric, value := range m {
+				if labels, ok := frameworkPrincipalMessagesKey.match(metric); ok {
+					c.(*settableCounterVec).Set(value, labels...)
 				}
 			}
 			return nil
@@ -0,0 +1,784 @@
+// Maintain a model of the cluster from the master's v1 Operator API SUBSCRIBE
+// event stream, so that the master state metrics can be served without
+// polling the /state endpoint on every scrape.
+//
+// The stream starts with a SUBSCRIBED event containing a full snapshot of the
+// master state, followed by TASK_*, AGENT_* and FRAMEWORK_* events, and
+// periodic HEARTBEAT events. Events are framed with RecordIO, see
+// http://mesos.apache.org/documentation/latest/recordio/
+//
+// Subscribing to a master that is not the leader is redirected to the
+// leading master. When the stream ends, e.g. because the leader changed, or
+// no heartbeat is received, the subscriber reconnects and replaces its model
+// with the snapshot of the new SUBSCRIBED event.
+//
+// Besides the state, TASK_UPDATED events are counted by the state transition
+// they represent ("mesos_task_transitions_total"). Transitions happening while
+// the subscriber is disconnected are not counted.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultHeartbeatInterval is used until the master announced its
+	// heartbeat interval in the SUBSCRIBED event.
+	defaultHeartbeatInterval = 15 * time.Second
+	// missedHeartbeats is the number of heartbeat intervals without events
+	// after which the stream is considered dead.
+	missedHeartbeats = 3
+
+	minSubscribeBackoff = time.Second
+	maxSubscribeBackoff = 30 * time.Second
+
+	maxRecordSize = 1 << 30
+)
+
+var (
+	eventTypes  = []string{"UNKNOWN", "SUBSCRIBED", "TASK_ADDED", "TASK_UPDATED", "AGENT_ADDED", "AGENT_REMOVED", "FRAMEWORK_ADDED", "FRAMEWORK_UPDATED", "FRAMEWORK_REMOVED", "HEARTBEAT"}
+	taskSources = []string{"SOURCE_MASTER", "SOURCE_AGENT", "SOURCE_EXECUTOR"}
+	taskStates  = []string{
+		0:  "TASK_STARTING",
+		1:  "TASK_RUNNING",
+		2:  "TASK_FINISHED",
+		3:  "TASK_FAILED",
+		4:  "TASK_KILLED",
+		5:  "TASK_LOST",
+		6:  "TASK_STAGING",
+		7:  "TASK_ERROR",
+		8:  "TASK_KILLING",
+		9:  "TASK_DROPPED",
+		10: "TASK_UNREACHABLE",
+		11: "TASK_GONE",
+		12: "TASK_GONE_BY_OPERATOR",
+		13: "TASK_UNKNOWN",
+	}
+	taskReasons = []string{
+		0:  "REASON_COMMAND_EXECUTOR_FAILED",
+		1:  "REASON_EXECUTOR_TERMINATED",
+		2:  "REASON_EXECUTOR_UNREGISTERED",
+		3:  "REASON_FRAMEWORK_REMOVED",
+		4:  "REASON_GC_ERROR",
+		5:  "REASON_INVALID_FRAMEWORKID",
+		6:  "REASON_INVALID_OFFERS",
+		7:  "REASON_MASTER_DISCONNECTED",
+		8:  "REASON_CONTAINER_LIMITATION_MEMORY",
+		9:  "REASON_RECONCILIATION",
+		10: "REASON_AGENT_DISCONNECTED",
+		11: "REASON_AGENT_REMOVED",
+		12: "REASON_AGENT_RESTARTED",
+		13: "REASON_AGENT_UNKNOWN",
+		14: "REASON_TASK_INVALID",
+		15: "REASON_TASK_UNAUTHORIZED",
+		16: "REASON_TASK_UNKNOWN",
+		17: "REASON_CONTAINER_PREEMPTED",
+		18: "REASON_RESOURCES_UNKNOWN",
+		19: "REASON_CONTAINER_LIMITATION",
+		20: "REASON_CONTAINER_LIMITATION_DISK",
+		21: "REASON_CONTAINER_LAUNCH_FAILED",
+		22: "REASON_CONTAINER_UPDATE_FAILED",
+		23: "REASON_EXECUTOR_REGISTRATION_TIMEOUT",
+		24: "REASON_EXECUTOR_REREGISTRATION_TIMEOUT",
+		25: "REASON_TASK_GROUP_INVALID",
+		26: "REASON_TASK_GROUP_UNAUTHORIZED",
+		27: "REASON_IO_SWITCHBOARD_EXITED",
+		28: "REASON_TASK_CHECK_STATUS_UPDATED",
+		29: "REASON_TASK_HEALTH_CHECK_STATUS_UPDATED",
+		30: "REASON_TASK_KILLED_DURING_LAUNCH",
+		31: "REASON_AGENT_REMOVED_BY_OPERATOR",
+		32: "REASON_AGENT_REREGISTERED",
+		33: "REASON_MAX_COMPLETION_TIME_REACHED",
+		34: "REASON_AGENT_DRAINING",
+	}
+	// terminalTaskStates are the states after which a task is removed
+	// from the model.
+	terminalTaskStates = map[string]bool{
+		"TASK_FINISHED":         true,
+		"TASK_FAILED":           true,
+		"TASK_KILLED":           true,
+		"TASK_ERROR":            true,
+		"TASK_LOST":             true,
+		"TASK_DROPPED":          true,
+		"TASK_GONE":             true,
+		"TASK_GONE_BY_OPERATOR": true,
+	}
+)
+
+type (
+	v1Event struct {
+		Type       string `json:"type"`
+		Subscribed *struct {
+			GetState                 v1GetState `json:"get_state"`
+			HeartbeatIntervalSeconds float64    `json:"heartbeat_interval_seconds"`
+		} `json:"subscribed"`
+		TaskAdded *struct {
+			Task v1Task `json:"task"`
+		} `json:"task_added"`
+		TaskUpdated *struct {
+			FrameworkID v1ID         `json:"framework_id"`
+			Status      v1TaskStatus `json:"status"`
+			State       string       `json:"state"`
+		} `json:"task_updated"`
+		AgentAdded *struct {
+			Agent v1Agent `json:"agent"`
+		} `json:"agent_added"`
+		AgentRemoved *struct {
+			AgentID v1ID `json:"agent_id"`
+		} `json:"agent_removed"`
+		FrameworkAdded *struct {
+			Framework v1Framework `json:"framework"`
+		} `json:"framework_added"`
+		FrameworkUpdated *struct {
+			Framework v1Framework `json:"framework"`
+		} `json:"framework_updated"`
+		FrameworkRemoved *struct {
+			FrameworkInfo v1FrameworkInfo `json:"framework_info"`
+		} `json:"framework_removed"`
+	}
+
+	v1GetState struct {
+		GetTasks struct {
+			Tasks            []v1Task `json:"tasks"`
+			UnreachableTasks []v1Task `json:"unreachable_tasks"`
+		} `json:"get_tasks"`
+		GetFrameworks struct {
+			Frameworks []v1Framework `json:"frameworks"`
+		} `json:"get_frameworks"`
+		GetAgents v1GetAgents `json:"get_agents"`
+	}
+
+	v1Task struct {
+		Name        string         `json:"name"`
+		TaskID      v1ID           `json:"task_id"`
+		FrameworkID v1ID           `json:"framework_id"`
+		ExecutorID  v1ID           `json:"executor_id"`
+		AgentID     v1ID           `json:"agent_id"`
+		State       string         `json:"state"`
+		Resources   []v1Resource   `json:"resources"`
+		Statuses    []v1TaskStatus `json:"statuses"`
+		Labels      struct {
+			Labels []label `json:"labels"`
+		} `json:"labels"`
+	}
+	v1TaskStatus struct {
+		TaskID    v1ID    `json:"task_id"`
+		State     string  `json:"state"`
+		Source    string  `json:"source"`
+		Reason    string  `json:"reason"`
+		Timestamp float64 `json:"timestamp"`
+	}
+
+	v1Framework struct {
+		FrameworkInfo v1FrameworkInfo `json:"framework_info"`
+		Active        bool            `json:"active"`
+	}
+	v1FrameworkInfo struct {
+		ID        v1ID     `json:"id"`
+		Name      string   `json:"name"`
+		User      string   `json:"user"`
+		Role      string   `json:"role"`
+		Roles     []string `json:"roles"`
+		Principal string   `json:"principal"`
+	}
+
+	taskKey struct {
+		framework, task string
+	}
+
+	// clusterModel is the state of the cluster as seen through the events.
+	clusterModel struct {
+		synced     bool
+		agents     map[string]v1Agent
+		frameworks map[string]v1Framework
+		tasks      map[taskKey]v1Task
+	}
+
+	masterSubscriber struct {
+		client *httpClient
+
+		mu    sync.Mutex
+		model clusterModel
+
+		connected     prometheus.Gauge
+		subscriptions prometheus.Counter
+		events        *prometheus.CounterVec
+		transitions   *prometheus.CounterVec
+		// transitionLabels are the labels of transitions, a subset of
+		// taskTransitionLabels.
+		transitionLabels []string
+	}
+)
+
+// taskTransitionLabels are the labels of "mesos_task_transitions_total".
+var taskTransitionLabels = []string{"framework", "from_state", "to_state", "reason", "source"}
+
+// newMasterSubscriber returns a subscriber to the event stream of the master.
+// The labels in dropTransitionLabels are omitted from the task transition
+// counter to bound its cardinality.
+func newMasterSubscriber(client *httpClient, dropTransitionLabels []string) *masterSubscriber {
+	// The stream is kept open indefinitely, so it must not be subject to
+	// the client timeout. Dead streams are detected via heartbeats.
+	stream := *client
+	stream.Timeout = 0
+	stream.timeouts = nil
+
+	var transitionLabels []string
+	for _, label := range taskTransitionLabels {
+		if !stringInSlice(label, dropTransitionLabels) {
+			transitionLabels = append(transitionLabels, label)
+		}
+	}
+
+	return &masterSubscriber{
+		client: &stream,
+		connected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "mesos",
+			Subsystem: "exporter",
+			Name:      "event_stream_connected",
+			Help:      "Whether the exporter is subscribed to the master's event stream",
+		}),
+		subscriptions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "mesos",
+			Subsystem: "exporter",
+			Name:      "event_stream_subscriptions_total",
+			Help:      "Total number of subscriptions to the master's event stream, each resyncing the cluster state",
+		}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mesos",
+			Subsystem: "exporter",
+			Name:      "event_stream_events_total",
+			Help:      "Total number of events received from the master's event stream",
+		}, []string{"type"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mesos",
+			Subsystem: "task",
+			Name:      "transitions_total",
+			Help:      "Total number of task state transitions seen in the master's event stream",
+		}, transitionLabels),
+		transitionLabels: transitionLabels,
+	}
+}
+
+// run subscribes to the event stream and resubscribes with exponential
+// backoff whenever the stream ends, until ctx is done.
+func (s *masterSubscriber) run(ctx context.Context) {
+	backoff := minSubscribeBackoff
+	for {
+		synced, err := s.subscribe(ctx)
+
+		s.mu.Lock()
+		s.model.synced = false
+		s.mu.Unlock()
+		s.connected.Set(0)
+
+		if ctx.Err() != nil {
+			return
+		}
+		if synced {
+			backoff = minSubscribeBackoff
+		}
+		log.WithFields(log.Fields{
+			"url":   s.client.url,
+			"error": err,
+			"retry": backoff,
+		}).Error("Event stream ended")
+		errorCounter.Inc()
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > maxSubscribeBackoff {
+			backoff = maxSubscribeBackoff
+		}
+	}
+}
+
+// subscribe consumes the event stream until it ends or ctx is done, and
+// reports whether the model was synced from it.
+func (s *masterSubscriber) subscribe(parent context.Context) (synced bool, err error) {
+	req, ok := s.client.newOperatorRequest("SUBSCRIBE")
+	if !ok {
+		return false, errors.New("cannot create request")
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	res, ok := s.client.do(req)
+	if !ok {
+		return false, errors.New("request failed")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	timeout := missedHeartbeats * defaultHeartbeatInterval
+	watchdog := time.AfterFunc(timeout, cancel)
+	defer watchdog.Stop()
+
+	protobuf := strings.HasPrefix(res.Header.Get("Content-Type"), operatorProtobuf)
+	r := bufio.NewReader(res.Body)
+	for {
+		record, err := readRecord(r)
+		if err != nil {
+			if ctx.Err() != nil && parent.Err() == nil {
+				err = fmt.Errorf("no heartbeat received within %s", timeout)
+			}
+			return synced, err
+		}
+		watchdog.Reset(timeout)
+
+		var e v1Event
+		if protobuf {
+			p := newProtoReader(record)
+			e.unmarshalProtobuf(p)
+			err = p.err
+		} else {
+			err = json.Unmarshal(record, &e)
+		}
+		if err != nil {
+			return synced, err
+		}
+		s.events.WithLabelValues(e.Type).Inc()
+
+		if e.Subscribed != nil {
+			if interval := e.Subscribed.HeartbeatIntervalSeconds; interval > 0 {
+				timeout = missedHeartbeats * time.Duration(interval*float64(time.Second))
+				watchdog.Reset(timeout)
+			}
+			synced = true
+			s.subscriptions.Inc()
+			s.connected.Set(1)
+			log.WithField("url", s.client.url).Info("Subscribed to event stream")
+		}
+
+		s.mu.Lock()
+		if e.TaskUpdated != nil && s.model.synced {
+			s.countTransition(&e)
+		}
+		s.model.apply(&e)
+		s.mu.Unlock()
+	}
+}
+
+// countTransition counts the state transition of a TASK_UPDATED event. Status
+// updates that do not change the state of the task, such as health check
+// updates, are not counted. Neither are updates of tasks unknown to the
+// model, such as duplicate updates of tasks that already reached a terminal
+// state and were removed.
+func (s *masterSubscriber) countTransition(e *v1Event) {
+	u := e.TaskUpdated
+	t, ok := s.model.tasks[taskKey{u.FrameworkID.Value, u.Status.TaskID.Value}]
+	if !ok || t.State == u.State {
+		return
+	}
+
+	framework := u.FrameworkID.Value
+	if f, ok := s.model.frameworks[framework]; ok && f.FrameworkInfo.Name != "" {
+		framework = f.FrameworkInfo.Name
+	}
+	values := map[string]string{
+		"framework":  framework,
+		"from_state": t.State,
+		"to_state":   u.State,
+		"reason":     u.Status.Reason,
+		"source":     u.Status.Source,
+	}
+	s.transitions.WithLabelValues(getLabelValuesFromMap(values, s.transitionLabels)...).Inc()
+}
+
+// state returns the master state built from the model, and whether the
+// model is in sync with the master.
+func (s *masterSubscriber) state() (state, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.model.synced {
+		return state{}, false
+	}
+	return s.model.state(), true
+}
+
+func (s *masterSubscriber) Collect(ch chan<- prometheus.Metric) {
+	s.connected.Collect(ch)
+	s.subscriptions.Collect(ch)
+	s.events.Collect(ch)
+	s.transitions.Collect(ch)
+}
+
+func (s *masterSubscriber) Describe(ch chan<- *prometheus.Desc) {
+	s.connected.Describe(ch)
+	s.subscriptions.Describe(ch)
+	s.events.Describe(ch)
+	s.transitions.Describe(ch)
+}
+
+// apply updates the model with an event. The SUBSCRIBED event replaces the
+// whole model.
+func (m *clusterModel) apply(e *v1Event) {
+	switch {
+	case e.Subscribed != nil:
+		st := &e.Subscribed.GetState
+		*m = clusterModel{
+			synced:     true,
+			agents:     map[string]v1Agent{},
+			frameworks: map[string]v1Framework{},
+			tasks:      map[taskKey]v1Task{},
+		}
+		for _, a := range st.GetAgents.Agents {
+			m.agents[a.AgentInfo.ID.Value] = a
+		}
+		for _, f := range st.GetFrameworks.Frameworks {
+			m.frameworks[f.FrameworkInfo.ID.Value] = f
+		}
+		for _, tasks := range [][]v1Task{st.GetTasks.Tasks, st.GetTasks.UnreachableTasks} {
+			for _, t := range tasks {
+				m.tasks[t.key()] = t
+			}
+		}
+
+	case !m.synced:
+		// Events before the snapshot cannot be applied.
+
+	case e.TaskAdded != nil:
+		m.tasks[e.TaskAdded.Task.key()] = e.TaskAdded.Task
+
+	case e.TaskUpdated != nil:
+		u := e.TaskUpdated
+		key := taskKey{u.FrameworkID.Value, u.Status.TaskID.Value}
+		t, ok := m.tasks[key]
+		if !ok {
+			return
+		}
+		if terminalTaskStates[u.State] {
+			delete(m.tasks, key)
+			return
+		}
+		t.State = u.State
+		t.Statuses = append(t.Statuses, u.Status)
+		m.tasks[key] = t
+
+	case e.AgentAdded != nil:
+		a := e.AgentAdded.Agent
+		m.agents[a.AgentInfo.ID.Value] = a
+
+	case e.AgentRemoved != nil:
+		delete(m.agents, e.AgentRemoved.AgentID.Value)
+
+	case e.FrameworkAdded != nil:
+		f := e.FrameworkAdded.Framework
+		m.frameworks[f.FrameworkInfo.ID.Value] = f
+
+	case e.FrameworkUpdated != nil:
+		f := e.FrameworkUpdated.Framework
+		m.frameworks[f.FrameworkInfo.ID.Value] = f
+
+	case e.FrameworkRemoved != nil:
+		id := e.FrameworkRemoved.FrameworkInfo.ID.Value
+		delete(m.frameworks, id)
+		for key := range m.tasks {
+			if key.framework == id {
+				delete(m.tasks, key)
+			}
+		}
+	}
+}
+
+// state converts the model to the representation of the master's /state
+// endpoint. The resources used on an agent are the sum of the resources of
+// its non-terminal tasks, as allocations are not part of the events.
+func (m *clusterModel) state() state {
+	var st state
+	used := map[string]*resources{}
+	frameworks := map[string]*framework{}
+	for id, f := range m.frameworks {
+		frameworks[id] = &framework{Active: f.Active}
+	}
+
+	for _, t := range m.tasks {
+		converted := t.task()
+		if f, ok := frameworks[converted.FrameworkID]; ok {
+			f.Tasks = append(f.Tasks, converted)
+		}
+		if used[converted.SlaveID] == nil {
+			used[converted.SlaveID] = &resources{}
+		}
+		for _, r := range t.Resources {
+			used[converted.SlaveID].add(r)
+		}
+	}
+
+	for id, a := range m.agents {
+		s := a.slave()
+		s.Used = resources{}
+		if u := used[id]; u != nil {
+			s.Used = *u
+		}
+		st.Slaves = append(st.Slaves, s)
+	}
+	for _, f := range frameworks {
+		st.Frameworks = append(st.Frameworks, *f)
+	}
+	return st
+}
+
+func (t *v1Task) key() taskKey {
+	return taskKey{t.FrameworkID.Value, t.TaskID.Value}
+}
+
+// task converts the task to the representation of the master's /state
+// endpoint.
+func (t *v1Task) task() task {
+	converted := task{
+		Name:        t.Name,
+		ID:          t.TaskID.Value,
+		ExecutorID:  t.ExecutorID.Value,
+		FrameworkID: t.FrameworkID.Value,
+		SlaveID:     t.AgentID.Value,
+		State:       t.State,
+		Labels:      t.Labels.Labels,
+	}
+	for _, r := range t.Resources {
+		converted.Resources.add(r)
+	}
+	for _, s := range t.Statuses {
+		converted.Statuses = append(converted.Statuses, status{State: s.State, Timestamp: s.Timestamp})
+	}
+	return converted
+}
+
+// readRecord reads a RecordIO record, which is the length of the record in
+// decimal followed by a newline and the record itself.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(line), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RecordIO header %q", line)
+	}
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("RecordIO record of %d bytes exceeds maximum size", size)
+	}
+	record := make([]byte, size)
+	_, err = io.ReadFull(r, record)
+	return record, err
+}
+
+func (e *v1Event) unmarshalProtobuf(r *protoReader) {
+	for r.next() {
+		switch r.field {
+		case 1:
+			e.Type = enumName(eventTypes, r.uint())
+		case 2:
+			e.Subscribed = &struct {
+				GetState                 v1GetState `json:"get_state"`
+				HeartbeatIntervalSeconds float64    `json:"heartbeat_interval_seconds"`
+			}{}
+			r.decode(func(r *protoReader) {
+				switch r.field {
+				case 1:
+					r.decode(e.Subscribed.GetState.unmarshalProtobuf)
+				case 2:
+					e.Subscribed.HeartbeatIntervalSeconds = r.double()
+				}
+			})
+		case 3:
+			e.TaskAdded = &struct {
+				Task v1Task `json:"task"`
+			}{}
+			r.decode(func(r *protoReader) {
+				if r.field == 1 {
+					r.decode(e.TaskAdded.Task.unmarshalProtobuf)
+				}
+			})
+		case 4:
+			e.TaskUpdated = &struct {
+				FrameworkID v1ID         `json:"framework_id"`
+				Status      v1TaskStatus `json:"status"`
+				State       string       `json:"state"`
+			}{}
+			r.decode(func(r *protoReader) {
+				switch r.field {
+				case 1:
+					r.decode(e.TaskUpdated.FrameworkID.unmarshalProtobuf)
+				case 2:
+					r.decode(e.TaskUpdated.Status.unmarshalProtobuf)
+				case 3:
+					e.TaskUpdated.State = enumName(taskStates, r.uint())
+				}
+			})
+		case 5:
+			e.AgentAdded = &struct {
+				Agent v1Agent `json:"agent"`
+			}{}
+			r.decode(func(r *protoReader) {
+				if r.field == 1 {
+					r.decode(e.AgentAdded.Agent.unmarshalProtobuf)
+				}
+			})
+		case 6:
+			e.AgentRemoved = &struct {
+				AgentID v1ID `json:"agent_id"`
+			}{}
+			r.decode(func(r *protoReader) {
+				if r.field == 1 {
+					r.decode(e.AgentRemoved.AgentID.unmarshalProtobuf)
+				}
+			})
+		case 7:
+			e.FrameworkAdded = &struct {
+				Framework v1Framework `json:"framework"`
+			}{}
+			r.decode(func(r *protoReader) {
+				if r.field == 1 {
+					r.decode(e.FrameworkAdded.Framework.unmarshalProtobuf)
+				}
+			})
+		case 8:
+			e.FrameworkUpdated = &struct {
+				Framework v1Framework `json:"framework"`
+			}{}
+			r.decode(func(r *protoReader) {
+				if r.field == 1 {
+					r.decode(e.FrameworkUpdated.Framework.unmarshalProtobuf)
+				}
+			})
+		case 9:
+			e.FrameworkRemoved = &struct {
+				FrameworkInfo v1FrameworkInfo `json:"framework_info"`
+			}{}
+			r.decode(func(r *protoReader) {
+				if r.field == 1 {
+					r.decode(e.FrameworkRemoved.FrameworkInfo.unmarshalProtobuf)
+				}
+			})
+		}
+	}
+}
+
+func (st *v1GetState) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		r.decode(func(r *protoReader) {
+			var t v1Task
+			switch r.field {
+			case 2:
+				r.decode(t.unmarshalProtobuf)
+				st.GetTasks.Tasks = append(st.GetTasks.Tasks, t)
+			case 5:
+				r.decode(t.unmarshalProtobuf)
+				st.GetTasks.UnreachableTasks = append(st.GetTasks.UnreachableTasks, t)
+			}
+		})
+	case 3:
+		r.decode(func(r *protoReader) {
+			if r.field == 1 {
+				var f v1Framework
+				r.decode(f.unmarshalProtobuf)
+				st.GetFrameworks.Frameworks = append(st.GetFrameworks.Frameworks, f)
+			}
+		})
+	case 4:
+		r.decode(st.GetAgents.unmarshalProtobuf)
+	}
+}
+
+func (t *v1Task) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		t.Name = r.string()
+	case 2:
+		r.decode(t.TaskID.unmarshalProtobuf)
+	case 3:
+		r.decode(t.FrameworkID.unmarshalProtobuf)
+	case 4:
+		r.decode(t.ExecutorID.unmarshalProtobuf)
+	case 5:
+		r.decode(t.AgentID.unmarshalProtobuf)
+	case 6:
+		t.State = enumName(taskStates, r.uint())
+	case 7:
+		var res v1Resource
+		r.decode(res.unmarshalProtobuf)
+		t.Resources = append(t.Resources, res)
+	case 8:
+		var s v1TaskStatus
+		r.decode(s.unmarshalProtobuf)
+		t.Statuses = append(t.Statuses, s)
+	case 11:
+		r.decode(func(r *protoReader) {
+			if r.field != 1 {
+				return
+			}
+			var l label
+			r.decode(func(r *protoReader) {
+				switch r.field {
+				case 1:
+					l.Key = r.string()
+				case 2:
+					l.Value = r.string()
+				}
+			})
+			t.Labels.Labels = append(t.Labels.Labels, l)
+		})
+	}
+}
+
+func (s *v1TaskStatus) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		r.decode(s.TaskID.unmarshalProtobuf)
+	case 2:
+		s.State = enumName(taskStates, r.uint())
+	case 6:
+		s.Timestamp = r.double()
+	case 9:
+		s.Source = enumName(taskSources, r.uint())
+	case 10:
+		s.Reason = enumName(taskReasons, r.uint())
+	}
+}
+
+func (f *v1Framework) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		r.decode(f.FrameworkInfo.unmarshalProtobuf)
+	case 2:
+		f.Active = r.bool()
+	}
+}
+
+func (f *v1FrameworkInfo) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		f.User = r.string()
+	case 2:
+		f.Name = r.string()
+	case 3:
+		r.decode(f.ID.unmarshalProtobuf)
+	case 6:
+		f.Role = r.string()
+	case 8:
+		f.Principal = r.string()
+	case 12:
+		f.Roles = append(f.Roles, r.string())
+	}
+}
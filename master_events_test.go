@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func recordIO(events ...string) string {
+	var s string
+	for _, e := range events {
+		s += fmt.Sprintf("%d\n%s", len(e), e)
+	}
+	return s
+}
+
+const (
+	subscribedEvent = `{"type":"SUBSCRIBED","subscribed":{"heartbeat_interval_seconds":15,"get_state":{
+  "get_agents":{"agents":[{"pid":"slave(1)@10.0.0.1:5051","agent_info":{"hostname":"agent1","id":{"value":"a1"}},
+    "total_resources":[{"name":"cpus","type":"SCALAR","scalar":{"value":4}}]}]},
+  "get_frameworks":{"frameworks":[{"framework_info":{"id":{"value":"f1"},"name":"marathon"},"active":true}]},
+  "get_tasks":{"tasks":[{"name":"t1","task_id":{"value":"t1"},"framework_id":{"value":"f1"},"agent_id":{"value":"a1"},"state":"TASK_RUNNING",
+    "resources":[{"name":"cpus","type":"SCALAR","scalar":{"value":1}}]}]}}}}`
+	taskAddedEvent = `{"type":"TASK_ADDED","task_added":{"task":{"name":"t2","task_id":{"value":"t2"},"framework_id":{"value":"f1"},"agent_id":{"value":"a1"},"state":"TASK_STAGING",
+  "resources":[{"name":"cpus","type":"SCALAR","scalar":{"value":0.5}}]}}}`
+	taskFinishedEvent = `{"type":"TASK_UPDATED","task_updated":{"framework_id":{"value":"f1"},"status":{"task_id":{"value":"t1"},"state":"TASK_FINISHED"},"state":"TASK_FINISHED"}}`
+	agentAddedEvent   = `{"type":"AGENT_ADDED","agent_added":{"agent":{"pid":"slave(1)@10.0.0.2:5051","agent_info":{"hostname":"agent2","id":{"value":"a2"}}}}}`
+	resubscribedEvent = `{"type":"SUBSCRIBED","subscribed":{"get_state":{
+  "get_agents":{"agents":[{"pid":"slave(1)@10.0.0.3:5051","agent_info":{"hostname":"agent3","id":{"value":"a3"}}}]}}}}`
+)
+
+func TestMasterSubscriber(t *testing.T) {
+	streams := []string{
+		recordIO(subscribedEvent, taskAddedEvent, taskFinishedEvent, agentAddedEvent, `{"type":"HEARTBEAT"}`),
+		recordIO(resubscribedEvent),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", operatorJSON)
+		w.Write([]byte(streams[0]))
+		streams = streams[1:]
+	}))
+	defer srv.Close()
+
+	s := newMasterSubscriber(&httpClient{url: srv.URL}, nil)
+	if _, ok := s.state(); ok {
+		t.Fatal("state available before subscribing")
+	}
+
+	if synced, _ := s.subscribe(context.Background()); !synced {
+		t.Fatal("not synced from first stream")
+	}
+	st, ok := s.state()
+	if !ok {
+		t.Fatal("state not available after subscribing")
+	}
+	pids := map[string]float64{}
+	for _, slave := range st.Slaves {
+		pids[slave.PID] = slave.Used.CPUs
+	}
+	want := map[string]float64{"slave(1)@10.0.0.1:5051": 0.5, "slave(1)@10.0.0.2:5051": 0}
+	if fmt.Sprint(pids) != fmt.Sprint(want) {
+		t.Errorf("got used CPUs %v, want %v", pids, want)
+	}
+	if len(st.Frameworks) != 1 || len(st.Frameworks[0].Tasks) != 1 || st.Frameworks[0].Tasks[0].ID != "t2" {
+		t.Errorf("got frameworks %+v, want one framework with task t2", st.Frameworks)
+	}
+
+	if synced, _ := s.subscribe(context.Background()); !synced {
+		t.Fatal("not synced from second stream")
+	}
+	st, _ = s.state()
+	var got []string
+	for _, slave := range st.Slaves {
+		got = append(got, slave.PID)
+	}
+	sort.Strings(got)
+	if fmt.Sprint(got) != "[slave(1)@10.0.0.3:5051]" {
+		t.Errorf("got slaves %v after resync, want only slave(1)@10.0.0.3:5051", got)
+	}
+}
+
+func TestMasterSubscriber_Transitions(t *testing.T) {
+	stream := recordIO(
+		subscribedEvent,
+		taskAddedEvent,
+		`{"type":"TASK_UPDATED","task_updated":{"framework_id":{"value":"f1"},"status":{"task_id":{"value":"t2"},"state":"TASK_RUNNING","source":"SOURCE_EXECUTOR"},"state":"TASK_RUNNING"}}`,
+		`{"type":"TASK_UPDATED","task_updated":{"framework_id":{"value":"f1"},"status":{"task_id":{"value":"t2"},"state":"TASK_RUNNING","source":"SOURCE_EXECUTOR","reason":"REASON_TASK_HEALTH_CHECK_STATUS_UPDATED"},"state":"TASK_RUNNING"}}`,
+		`{"type":"TASK_UPDATED","task_updated":{"framework_id":{"value":"f1"},"status":{"task_id":{"value":"t2"},"state":"TASK_FAILED","source":"SOURCE_AGENT","reason":"REASON_CONTAINER_LIMITATION_MEMORY"},"state":"TASK_FAILED"}}`,
+		taskFinishedEvent,
+		// Duplicate updates of terminal tasks and updates of unknown tasks
+		// are not counted.
+		taskFinishedEvent,
+		`{"type":"TASK_UPDATED","task_updated":{"framework_id":{"value":"f1"},"status":{"task_id":{"value":"t9"},"state":"TASK_LOST"},"state":"TASK_LOST"}}`,
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(stream))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		drop []string
+		want map[string]float64
+	}{
+		{nil, map[string]float64{
+			"marathon/TASK_STAGING/TASK_RUNNING//SOURCE_EXECUTOR":                               1,
+			"marathon/TASK_RUNNING/TASK_FAILED/REASON_CONTAINER_LIMITATION_MEMORY/SOURCE_AGENT": 1,
+			"marathon/TASK_RUNNING/TASK_FINISHED//":                                             1,
+		}},
+		{[]string{"framework", "reason"}, map[string]float64{
+			"TASK_STAGING/TASK_RUNNING/SOURCE_EXECUTOR": 1,
+			"TASK_RUNNING/TASK_FAILED/SOURCE_AGENT":     1,
+			"TASK_RUNNING/TASK_FINISHED/":               1,
+		}},
+	} {
+		s := newMasterSubscriber(&httpClient{url: srv.URL}, tt.drop)
+		s.subscribe(context.Background())
+
+		ch := make(chan prometheus.Metric, 10)
+		s.transitions.Collect(ch)
+		close(ch)
+		got := map[string]float64{}
+		for m := range ch {
+			var pb dto.Metric
+			m.Write(&pb)
+			got[labelKey(pb.GetLabel(), s.transitionLabels)] = pb.GetCounter().GetValue()
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("drop %v: got %v, want %v", tt.drop, got, tt.want)
+		}
+	}
+}
+
+func labelKey(pairs []*dto.LabelPair, names []string) string {
+	values := map[string]string{}
+	for _, l := range pairs {
+		values[l.GetName()] = l.GetValue()
+	}
+	var key []string
+	for _, name := range names {
+		key = append(key, values[name])
+	}
+	return strings.Join(key, "/")
+}
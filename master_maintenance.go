@@ -0,0 +1,261 @@
+// Scrape the master's /maintenance/schedule and /maintenance/status endpoints
+// and the v1 Operator API GET_AGENTS call to get information on maintenance
+// windows and agent draining. Information scraped at this point:
+//
+// * Maintenance mode of machines ("mesos_slave_maintenance_mode")
+// * Maintenance window boundaries ("mesos_slave_maintenance_window_*")
+// * Inverse offer responses of frameworks ("mesos_slave_maintenance_inverse_offers")
+// * Drain state and progress of agents ("mesos_slave_drain_*")
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	machineID struct {
+		Hostname string `json:"hostname"`
+		IP       string `json:"ip"`
+	}
+
+	maintenanceSchedule struct {
+		Windows []maintenanceWindow `json:"windows"`
+	}
+	maintenanceWindow struct {
+		MachineIDs     []machineID `json:"machine_ids"`
+		Unavailability struct {
+			Start    nanoseconds  `json:"start"`
+			Duration *nanoseconds `json:"duration"`
+		} `json:"unavailability"`
+	}
+
+	maintenanceStatus struct {
+		DrainingMachines []drainingMachine `json:"draining_machines"`
+		DownMachines     []machineID       `json:"down_machines"`
+	}
+	drainingMachine struct {
+		ID       machineID `json:"id"`
+		Statuses []struct {
+			Status string `json:"status"`
+		} `json:"statuses"`
+	}
+
+	maintenance struct {
+		schedule maintenanceSchedule
+		status   maintenanceStatus
+		agents   getAgentsResponse
+	}
+
+	masterMaintenanceCollector struct {
+		*httpClient
+		metrics map[*prometheus.Desc]maintenanceMetric
+	}
+	maintenanceMetric struct {
+		valueType prometheus.ValueType
+		value     func(*maintenance) []metricValue
+	}
+)
+
+var (
+	maintenanceModes = []string{"draining", "down", "up"}
+	drainStates      = []string{"draining", "drained"}
+)
+
+func newMasterMaintenanceCollector(httpClient *httpClient) prometheus.Collector {
+	machineLabels := []string{"hostname", "ip"}
+	agentLabels := []string{"slave", "hostname"}
+
+	return &masterMaintenanceCollector{
+		httpClient: httpClient,
+		metrics: map[*prometheus.Desc]maintenanceMetric{
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "maintenance_mode"),
+				"Maintenance mode of machines known to the maintenance schedule",
+				append(machineLabels, "mode"),
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				modes := map[machineID]string{}
+				for _, w := range m.schedule.Windows {
+					for _, id := range w.MachineIDs {
+						modes[id] = "up"
+					}
+				}
+				for _, d := range m.status.DrainingMachines {
+					modes[d.ID] = "draining"
+				}
+				for _, id := range m.status.DownMachines {
+					modes[id] = "down"
+				}
+
+				res := []metricValue{}
+				for id, current := range modes {
+					for _, mode := range maintenanceModes {
+						var v float64
+						if mode == current {
+							v = 1
+						}
+						res = append(res, metricValue{v, []string{id.Hostname, id.IP, mode}})
+					}
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "maintenance_window_start_timestamp_seconds"),
+				"Start of the scheduled maintenance window of machines in seconds since the epoch",
+				machineLabels,
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, w := range m.schedule.Windows {
+					for _, id := range w.MachineIDs {
+						res = append(res, metricValue{w.Unavailability.Start.seconds(), []string{id.Hostname, id.IP}})
+					}
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "maintenance_window_end_timestamp_seconds"),
+				"End of the scheduled maintenance window of machines in seconds since the epoch",
+				machineLabels,
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, w := range m.schedule.Windows {
+					// Windows without a duration never end.
+					if w.Unavailability.Duration == nil {
+						continue
+					}
+					end := w.Unavailability.Start.seconds() + w.Unavailability.Duration.seconds()
+					for _, id := range w.MachineIDs {
+						res = append(res, metricValue{end, []string{id.Hostname, id.IP}})
+					}
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "maintenance_inverse_offers"),
+				"Number of frameworks per inverse offer response for draining machines",
+				append(machineLabels, "status"),
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, d := range m.status.DrainingMachines {
+					statuses := map[string]float64{"unknown": 0, "accept": 0, "decline": 0}
+					for _, s := range d.Statuses {
+						statuses[strings.ToLower(s.Status)]++
+					}
+					for status, count := range statuses {
+						res = append(res, metricValue{count, []string{d.ID.Hostname, d.ID.IP, status}})
+					}
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "drain_state"),
+				"Drain state of agents being drained",
+				append(agentLabels, "state"),
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, a := range m.agents.GetAgents.Agents {
+					if a.DrainInfo == nil {
+						continue
+					}
+					for _, state := range drainStates {
+						var v float64
+						if strings.EqualFold(a.DrainInfo.State, state) {
+							v = 1
+						}
+						res = append(res, metricValue{v, []string{a.PID, a.AgentInfo.Hostname, state}})
+					}
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "drain_start_timestamp_seconds"),
+				"Estimated start of the agent drain in seconds since the epoch",
+				agentLabels,
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, a := range m.agents.GetAgents.Agents {
+					if a.DrainInfo == nil || a.EstimatedDrainStartTime == nil {
+						continue
+					}
+					res = append(res, metricValue{a.EstimatedDrainStartTime.seconds(), []string{a.PID, a.AgentInfo.Hostname}})
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "drain_max_grace_period_seconds"),
+				"Maximum grace period given to tasks killed by the agent drain",
+				agentLabels,
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, a := range m.agents.GetAgents.Agents {
+					if a.DrainInfo == nil || a.DrainInfo.Config.MaxGracePeriod == nil {
+						continue
+					}
+					res = append(res, metricValue{a.DrainInfo.Config.MaxGracePeriod.seconds(), []string{a.PID, a.AgentInfo.Hostname}})
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "drain_allocated_resources"),
+				"Resources still allocated on agents being drained",
+				append(agentLabels, "resource"),
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, a := range m.agents.GetAgents.Agents {
+					if a.DrainInfo == nil {
+						continue
+					}
+					allocated := map[string]float64{"cpus": 0, "mem": 0, "disk": 0}
+					for _, r := range a.AllocatedResources {
+						if r.Scalar != nil {
+							allocated[r.Name] += r.Scalar.Value
+						}
+					}
+					for resource, value := range allocated {
+						res = append(res, metricValue{value, []string{a.PID, a.AgentInfo.Hostname, resource}})
+					}
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "slave", "deactivated"),
+				"Whether the agent is deactivated and receives no offers",
+				agentLabels,
+				nil): {prometheus.GaugeValue, func(m *maintenance) []metricValue {
+				res := []metricValue{}
+				for _, a := range m.agents.GetAgents.Agents {
+					var v float64
+					if a.Deactivated {
+						v = 1
+					}
+					res = append(res, metricValue{v, []string{a.PID, a.AgentInfo.Hostname}})
+				}
+				return res
+			}},
+		},
+	}
+}
+
+func (c *masterMaintenanceCollector) Collect(ch chan<- prometheus.Metric) {
+	var m maintenance
+	log.WithField("url", "/maintenance/schedule").Debug("fetching URL")
+	c.fetchAndDecode("/maintenance/schedule", &m.schedule)
+	log.WithField("url", "/maintenance/status").Debug("fetching URL")
+	c.fetchAndDecode("/maintenance/status", &m.status)
+	log.WithField("call", "GET_AGENTS").Debug("calling operator API")
+	c.callOperator("GET_AGENTS", &m.agents)
+
+	for d, cm := range c.metrics {
+		for _, v := range cm.value(&m) {
+			ch <- prometheus.MustNewConstMetric(d, cm.valueType, v.result, v.labels...)
+		}
+	}
+}
+
+func (c *masterMaintenanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for d := range c.metrics {
+		ch <- d
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const maintenanceScheduleFixture = `{"windows": [
+  {"machine_ids": [{"hostname": "agent1", "ip": "10.0.0.1"}, {"hostname": "agent2", "ip": "10.0.0.2"}],
+   "unavailability": {"start": {"nanoseconds": 1600000000000000000}, "duration": {"nanoseconds": 3600000000000}}},
+  {"machine_ids": [{"hostname": "agent3", "ip": "10.0.0.3"}],
+   "unavailability": {"start": {"nanoseconds": 1700000000000000000}}}
+]}`
+
+const maintenanceStatusFixture = `{
+  "draining_machines": [{"id": {"hostname": "agent1", "ip": "10.0.0.1"}, "statuses": [
+    {"status": "ACCEPT", "framework_id": {"value": "f1"}, "timestamp": {"nanoseconds": 1600000001000000000}},
+    {"status": "DECLINE", "framework_id": {"value": "f2"}, "timestamp": {"nanoseconds": 1600000002000000000}}
+  ]}],
+  "down_machines": [{"hostname": "agent2", "ip": "10.0.0.2"}]
+}`
+
+const maintenanceAgentsFixture = `{"type": "GET_AGENTS", "get_agents": {"agents": [
+  {"agent_info": {"hostname": "agent1", "id": {"value": "a1"}}, "pid": "slave(1)@10.0.0.1:5051",
+   "active": true, "deactivated": true,
+   "allocated_resources": [
+     {"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.5}},
+     {"name": "mem", "type": "SCALAR", "scalar": {"value": 256}}
+   ],
+   "drain_info": {"state": "DRAINING", "config": {"max_grace_period": {"nanoseconds": 60000000000}, "mark_gone": false}},
+   "estimated_drain_start_time": {"nanoseconds": 1600000000000000000}},
+  {"agent_info": {"hostname": "agent2", "id": {"value": "a2"}}, "pid": "slave(1)@10.0.0.2:5051",
+   "active": true, "deactivated": true,
+   "drain_info": {"state": "DRAINED", "config": {"mark_gone": true}}},
+  {"agent_info": {"hostname": "agent3", "id": {"value": "a3"}}, "pid": "slave(1)@10.0.0.3:5051",
+   "active": true}
+]}}`
+
+// maintenanceAgentsProtobuf returns maintenanceAgentsFixture as protobuf.
+func maintenanceAgentsProtobuf() []byte {
+	agent := func(hostname, id, pid string, deactivated bool) []byte {
+		var info []byte
+		info = appendProtoString(info, 1, hostname)
+		info = appendProtoBytes(info, 6, appendProtoString(nil, 1, id))
+		a := appendProtoBytes(nil, 1, info)
+		a = appendProtoVarint(a, 2, 1)
+		a = appendProtoString(a, 4, pid)
+		if deactivated {
+			a = appendProtoVarint(a, 12, 1)
+		}
+		return a
+	}
+	scalar := func(name string, value float64) []byte {
+		return appendProtoBytes(appendProtoString(nil, 1, name), 3, appendProtoDouble(nil, 1, value))
+	}
+
+	a1 := agent("agent1", "a1", "slave(1)@10.0.0.1:5051", true)
+	a1 = appendProtoBytes(a1, 8, scalar("cpus", 1.5))
+	a1 = appendProtoBytes(a1, 8, scalar("mem", 256))
+	config := appendProtoBytes(nil, 1, appendProtoVarint(nil, 1, 60000000000))
+	a1 = appendProtoBytes(a1, 13, appendProtoBytes(appendProtoVarint(nil, 1, 1), 2, config))
+	a1 = appendProtoBytes(a1, 14, appendProtoVarint(nil, 1, 1600000000000000000))
+
+	a2 := agent("agent2", "a2", "slave(1)@10.0.0.2:5051", true)
+	a2 = appendProtoBytes(a2, 13, appendProtoBytes(appendProtoVarint(nil, 1, 2), 2, appendProtoVarint(nil, 2, 1)))
+
+	a3 := agent("agent3", "a3", "slave(1)@10.0.0.3:5051", false)
+
+	var agents []byte
+	for _, a := range [][]byte{a1, a2, a3} {
+		agents = appendProtoBytes(agents, 1, a)
+	}
+	return appendProtoBytes(appendProtoVarint(nil, 1, 10), 10, agents)
+}
+
+func TestMasterMaintenanceCollector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/maintenance/schedule":
+			w.Write([]byte(maintenanceScheduleFixture))
+		case "/maintenance/status":
+			w.Write([]byte(maintenanceStatusFixture))
+		case "/api/v1":
+			if r.Header.Get("Content-Type") == operatorProtobuf {
+				w.Header().Set("Content-Type", operatorProtobuf)
+				w.Write(maintenanceAgentsProtobuf())
+				return
+			}
+			w.Write([]byte(maintenanceAgentsFixture))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	want := map[string]float64{
+		"mesos_slave_maintenance_mode{hostname=agent1,ip=10.0.0.1,mode=draining}": 1,
+		"mesos_slave_maintenance_mode{hostname=agent1,ip=10.0.0.1,mode=down}":     0,
+		"mesos_slave_maintenance_mode{hostname=agent1,ip=10.0.0.1,mode=up}":       0,
+		"mesos_slave_maintenance_mode{hostname=agent2,ip=10.0.0.2,mode=draining}": 0,
+		"mesos_slave_maintenance_mode{hostname=agent2,ip=10.0.0.2,mode=down}":     1,
+		"mesos_slave_maintenance_mode{hostname=agent2,ip=10.0.0.2,mode=up}":       0,
+		"mesos_slave_maintenance_mode{hostname=agent3,ip=10.0.0.3,mode=draining}": 0,
+		"mesos_slave_maintenance_mode{hostname=agent3,ip=10.0.0.3,mode=down}":     0,
+		"mesos_slave_maintenance_mode{hostname=agent3,ip=10.0.0.3,mode=up}":       1,
+
+		"mesos_slave_maintenance_window_start_timestamp_seconds{hostname=agent1,ip=10.0.0.1}": 1600000000,
+		"mesos_slave_maintenance_window_start_timestamp_seconds{hostname=agent2,ip=10.0.0.2}": 1600000000,
+		"mesos_slave_maintenance_window_start_timestamp_seconds{hostname=agent3,ip=10.0.0.3}": 1700000000,
+		"mesos_slave_maintenance_window_end_timestamp_seconds{hostname=agent1,ip=10.0.0.1}":   1600003600,
+		"mesos_slave_maintenance_window_end_timestamp_seconds{hostname=agent2,ip=10.0.0.2}":   1600003600,
+
+		"mesos_slave_maintenance_inverse_offers{hostname=agent1,ip=10.0.0.1,status=accept}":  1,
+		"mesos_slave_maintenance_inverse_offers{hostname=agent1,ip=10.0.0.1,status=decline}": 1,
+		"mesos_slave_maintenance_inverse_offers{hostname=agent1,ip=10.0.0.1,status=unknown}": 0,
+
+		"mesos_slave_drain_state{hostname=agent1,slave=slave(1)@10.0.0.1:5051,state=draining}": 1,
+		"mesos_slave_drain_state{hostname=agent1,slave=slave(1)@10.0.0.1:5051,state=drained}":  0,
+		"mesos_slave_drain_state{hostname=agent2,slave=slave(1)@10.0.0.2:5051,state=draining}": 0,
+		"mesos_slave_drain_state{hostname=agent2,slave=slave(1)@10.0.0.2:5051,state=drained}":  1,
+
+		"mesos_slave_drain_start_timestamp_seconds{hostname=agent1,slave=slave(1)@10.0.0.1:5051}":  1600000000,
+		"mesos_slave_drain_max_grace_period_seconds{hostname=agent1,slave=slave(1)@10.0.0.1:5051}": 60,
+
+		"mesos_slave_drain_allocated_resources{hostname=agent1,resource=cpus,slave=slave(1)@10.0.0.1:5051}": 1.5,
+		"mesos_slave_drain_allocated_resources{hostname=agent1,resource=mem,slave=slave(1)@10.0.0.1:5051}":  256,
+		"mesos_slave_drain_allocated_resources{hostname=agent1,resource=disk,slave=slave(1)@10.0.0.1:5051}": 0,
+		"mesos_slave_drain_allocated_resources{hostname=agent2,resource=cpus,slave=slave(1)@10.0.0.2:5051}": 0,
+		"mesos_slave_drain_allocated_resources{hostname=agent2,resource=mem,slave=slave(1)@10.0.0.2:5051}":  0,
+		"mesos_slave_drain_allocated_resources{hostname=agent2,resource=disk,slave=slave(1)@10.0.0.2:5051}": 0,
+
+		"mesos_slave_deactivated{hostname=agent1,slave=slave(1)@10.0.0.1:5051}": 1,
+		"mesos_slave_deactivated{hostname=agent2,slave=slave(1)@10.0.0.2:5051}": 1,
+		"mesos_slave_deactivated{hostname=agent3,slave=slave(1)@10.0.0.3:5051}": 0,
+	}
+
+	for _, contentType := range []string{operatorJSON, operatorProtobuf} {
+		got := gatherValues(t, newMasterMaintenanceCollector(&httpClient{url: srv.URL, operatorAPI: contentType}))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Scrape the master's /roles and /quota endpoints to get information on
+// roles, their weights and quota. Information scraped at this point:
+//
+// * Role weights and framework counts ("mesos_master_role_weight", "mesos_master_role_frameworks")
+// * Allocated, offered and reserved resources ("mesos_master_role_allocated" etc.)
+// * Quota guarantees, limits and consumption ("mesos_master_role_quota_*")
+//
+// Role names are taken verbatim from the JSON responses, so hierarchical
+// roles such as "eng/web" are exported unchanged.
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	roles struct {
+		Roles []role `json:"roles"`
+	}
+	role struct {
+		Name       string          `json:"name"`
+		Weight     float64         `json:"weight"`
+		Frameworks []string        `json:"frameworks"`
+		Allocated  scalarResources `json:"allocated"`
+		Offered    scalarResources `json:"offered"`
+		Reserved   scalarResources `json:"reserved"`
+		Quota      struct {
+			Guarantee scalarResources `json:"guarantee"`
+			Limit     scalarResources `json:"limit"`
+			Consumed  scalarResources `json:"consumed"`
+		} `json:"quota"`
+	}
+
+	quotaStatus struct {
+		// Infos is the pre-1.9 representation of quota guarantees.
+		Infos []struct {
+			Role      string       `json:"role"`
+			Guarantee []v1Resource `json:"guarantee"`
+		} `json:"infos"`
+		Configs []struct {
+			Role       string             `json:"role"`
+			Guarantees map[string]float64 `json:"guarantees"`
+			Limits     map[string]float64 `json:"limits"`
+		} `json:"configs"`
+	}
+
+	// scalarResources maps resource names to their scalar amount. Range and
+	// set resources such as ports are ignored.
+	scalarResources map[string]float64
+
+	roleState struct {
+		roles roles
+		quota quotaStatus
+	}
+
+	masterRolesCollector struct {
+		*httpClient
+		metrics map[*prometheus.Desc]roleMetric
+	}
+	roleMetric struct {
+		valueType prometheus.ValueType
+		value     func(*roleState) []metricValue
+	}
+)
+
+func newMasterRolesCollector(httpClient *httpClient) prometheus.Collector {
+	labels := []string{"role"}
+	resourceLabels := []string{"role", "resource"}
+
+	return &masterRolesCollector{
+		httpClient: httpClient,
+		metrics: map[*prometheus.Desc]roleMetric{
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_weight"),
+				"Weight of the role used for fair sharing",
+				labels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				res := []metricValue{}
+				for _, r := range st.roles.Roles {
+					res = append(res, metricValue{r.Weight, []string{r.Name}})
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_frameworks"),
+				"Number of frameworks subscribed to the role",
+				labels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				res := []metricValue{}
+				for _, r := range st.roles.Roles {
+					res = append(res, metricValue{float64(len(r.Frameworks)), []string{r.Name}})
+				}
+				return res
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_allocated"),
+				"Resources allocated to the role",
+				resourceLabels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				return roleResourceValues(st, func(r *role) scalarResources { return r.Allocated })
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_offered"),
+				"Resources offered to the role",
+				resourceLabels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				return roleResourceValues(st, func(r *role) scalarResources { return r.Offered })
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_reserved"),
+				"Resources reserved for the role",
+				resourceLabels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				return roleResourceValues(st, func(r *role) scalarResources { return r.Reserved })
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_quota_consumed"),
+				"Resources consumed towards the quota of the role",
+				resourceLabels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				return roleResourceValues(st, func(r *role) scalarResources { return r.Quota.Consumed })
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_quota_guarantee"),
+				"Resources guaranteed to the role via quota",
+				resourceLabels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				guarantees := map[string]scalarResources{}
+				for _, r := range st.roles.Roles {
+					if len(r.Quota.Guarantee) > 0 {
+						guarantees[r.Name] = r.Quota.Guarantee
+					}
+				}
+				for _, info := range st.quota.Infos {
+					g := scalarResources{}
+					for _, r := range info.Guarantee {
+						if r.Scalar != nil {
+							g[r.Name] += r.Scalar.Value
+						}
+					}
+					guarantees[info.Role] = g
+				}
+				for _, config := range st.quota.Configs {
+					guarantees[config.Role] = config.Guarantees
+				}
+				return quotaValues(guarantees)
+			}},
+			prometheus.NewDesc(
+				prometheus.BuildFQName("mesos", "master", "role_quota_limit"),
+				"Resource limits of the role via quota",
+				resourceLabels,
+				nil): {prometheus.GaugeValue, func(st *roleState) []metricValue {
+				limits := map[string]scalarResources{}
+				for _, r := range st.roles.Roles {
+					if len(r.Quota.Limit) > 0 {
+						limits[r.Name] = r.Quota.Limit
+					}
+				}
+				for _, config := range st.quota.Configs {
+					limits[config.Role] = config.Limits
+				}
+				return quotaValues(limits)
+			}},
+		},
+	}
+}
+
+func (c *masterRolesCollector) Collect(ch chan<- prometheus.Metric) {
+	var st roleState
+	log.WithField("url", "/roles").Debug("fetching URL")
+	c.fetchAndDecode("/roles", &st.roles)
+	log.WithField("url", "/quota").Debug("fetching URL")
+	c.fetchAndDecode("/quota", &st.quota)
+
+	for d, cm := range c.metrics {
+		for _, v := range cm.value(&st) {
+			ch <- prometheus.MustNewConstMetric(d, cm.valueType, v.result, v.labels...)
+		}
+	}
+}
+
+func (c *masterRolesCollector) Describe(ch chan<- *prometheus.Desc) {
+	for d := range c.metrics {
+		ch <- d
+	}
+}
+
+func (rs *scalarResources) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*rs = scalarResources{}
+	for name, value := range raw {
+		var v float64
+		if err := json.Unmarshal(value, &v); err != nil {
+			continue
+		}
+		(*rs)[name] = v
+	}
+	return nil
+}
+
+// roleResourceValues returns one value per role and scalar resource.
+func roleResourceValues(st *roleState, get func(*role) scalarResources) []metricValue {
+	res := []metricValue{}
+	for i := range st.roles.Roles {
+		r := &st.roles.Roles[i]
+		for name, value := range get(r) {
+			res = append(res, metricValue{value, []string{r.Name, name}})
+		}
+	}
+	return res
+}
+
+func quotaValues(quota map[string]scalarResources) []metricValue {
+	res := []metricValue{}
+	for role, resources := range quota {
+		for name, value := range resources {
+			res = append(res, metricValue{value, []string{role, name}})
+		}
+	}
+	return res
+}
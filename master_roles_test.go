@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestScalarResources_UnmarshalJSON(t *testing.T) {
+	var rs scalarResources
+	data := `{"cpus": 1.5, "mem": 1024.0, "ports": "[31000-31001]", "gpus": 0}`
+	if err := json.Unmarshal([]byte(data), &rs); err != nil {
+		t.Fatal(err)
+	}
+	want := scalarResources{"cpus": 1.5, "mem": 1024, "gpus": 0}
+	if !reflect.DeepEqual(rs, want) {
+		t.Errorf("got %v, want %v", rs, want)
+	}
+
+	if err := json.Unmarshal([]byte(`["cpus"]`), &rs); err == nil {
+		t.Error("expected error decoding a list")
+	}
+}
+
+func TestMasterRolesCollector(t *testing.T) {
+	for _, tt := range []struct {
+		version string
+		roles   string
+		quota   string
+		want    map[string]float64
+	}{{
+		// Before Mesos 1.9, the quota guarantees are only in the infos of
+		// /quota, as resource lists.
+		version: "1.8",
+		roles: `{"roles": [
+		  {"name": "eng/web", "weight": 2.0, "frameworks": ["f1", "f2"],
+		   "allocated": {"cpus": 1.5, "mem": 512.0, "ports": "[31000-31001]"},
+		   "offered": {"cpus": 0.5},
+		   "reserved": {"cpus": 2.0, "disk": 100.0}},
+		  {"name": "*", "weight": 1.0, "frameworks": []}
+		]}`,
+		quota: `{"infos": [
+		  {"role": "eng/web", "principal": "ops", "guarantee": [
+		    {"name": "cpus", "type": "SCALAR", "scalar": {"value": 4.0}},
+		    {"name": "ports", "type": "RANGES", "ranges": {"range": [{"begin": 31000, "end": 32000}]}}
+		  ]}
+		]}`,
+		want: map[string]float64{
+			"mesos_master_role_weight{role=eng/web}":                        2,
+			"mesos_master_role_weight{role=*}":                              1,
+			"mesos_master_role_frameworks{role=eng/web}":                    2,
+			"mesos_master_role_frameworks{role=*}":                          0,
+			"mesos_master_role_allocated{resource=cpus,role=eng/web}":       1.5,
+			"mesos_master_role_allocated{resource=mem,role=eng/web}":        512,
+			"mesos_master_role_offered{resource=cpus,role=eng/web}":         0.5,
+			"mesos_master_role_reserved{resource=cpus,role=eng/web}":        2,
+			"mesos_master_role_reserved{resource=disk,role=eng/web}":        100,
+			"mesos_master_role_quota_guarantee{resource=cpus,role=eng/web}": 4,
+		},
+	}, {
+		// Since Mesos 1.9, /roles has the quota of each role and /quota has
+		// configs with limits, which take precedence over both.
+		version: "1.9",
+		roles: `{"roles": [
+		  {"name": "eng/web", "weight": 2.0, "frameworks": ["f1"],
+		   "allocated": {"cpus": 1.5},
+		   "quota": {"role": "eng/web", "guarantee": {"cpus": 3.0}, "limit": {"cpus": 6.0},
+		             "consumed": {"cpus": 1.5, "mem": 512.0}}},
+		  {"name": "eng/batch", "weight": 1.0, "frameworks": [],
+		   "quota": {"role": "eng/batch", "guarantee": {"mem": 1024.0}, "limit": {}, "consumed": {}}}
+		]}`,
+		quota: `{"infos": [
+		  {"role": "eng/web", "guarantee": [{"name": "cpus", "type": "SCALAR", "scalar": {"value": 4.0}}]}
+		], "configs": [
+		  {"role": "eng/web", "guarantees": {"cpus": 5.0}, "limits": {"cpus": 10.0}}
+		]}`,
+		want: map[string]float64{
+			"mesos_master_role_weight{role=eng/web}":                         2,
+			"mesos_master_role_weight{role=eng/batch}":                       1,
+			"mesos_master_role_frameworks{role=eng/web}":                     1,
+			"mesos_master_role_frameworks{role=eng/batch}":                   0,
+			"mesos_master_role_allocated{resource=cpus,role=eng/web}":        1.5,
+			"mesos_master_role_quota_consumed{resource=cpus,role=eng/web}":   1.5,
+			"mesos_master_role_quota_consumed{resource=mem,role=eng/web}":    512,
+			"mesos_master_role_quota_guarantee{resource=cpus,role=eng/web}":  5,
+			"mesos_master_role_quota_guarantee{resource=mem,role=eng/batch}": 1024,
+			"mesos_master_role_quota_limit{resource=cpus,role=eng/web}":      10,
+		},
+	}} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/roles":
+				w.Write([]byte(tt.roles))
+			case "/quota":
+				w.Write([]byte(tt.quota))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		got := gatherValues(t, newMasterRolesCollector(&httpClient{url: srv.URL}))
+		srv.Close()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Mesos %s: got %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,6 +13,8 @@ import (
 
 type (
 	slave struct {
+		ID         string                     `json:"id"`
+		Hostname   string                     `json:"hostname"`
 		PID        string                     `json:"pid"`
 		Used       resources                  `json:"used_resources"`
 		Unreserved resources                  `json:"unreserved_resources"`
@@ -20,6 +23,8 @@ type (
 	}
 
 	framework struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
 		Active    bool   `json:"active"`
 		Tasks     []task `json:"tasks"`
 		Completed []task `json:"completed_tasks"`
@@ -33,10 +38,14 @@ type (
 	masterCollector struct {
 		*httpClient
 		metrics map[prometheus.Collector]func(*state, prometheus.Collector)
+		// endpoint is the state endpoint polled for the agents.
+		endpoint string
+		// subscriber serves the state from the event stream if not nil.
+		subscriber *masterSubscriber
 	}
 )
 
-func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []string) prometheus.Collector {
+func newMasterStateCollector(httpClient *httpClient, endpoint string, slaveAttributes *labelSelector, explodedAttributes []string) prometheus.Collector {
 	labels := []string{"slave"}
 	metrics := map[prometheus.Collector]func(*state, prometheus.Collector){
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -164,43 +173,57 @@ func newMasterStateCollector(httpClient *httpClient, slaveAttributeLabels []stri
 		},
 	}
 
-	if len(slaveAttributeLabels) > 0 {
-		normalisedAttributeLabels := normaliseLabelList(slaveAttributeLabels)
-		slaveAttributesLabelsExport := append(labels, normalisedAttributeLabels...)
-
-		metrics[counter("slave", "attributes", "Attributes assigned to slaves", slaveAttributesLabelsExport...)] = func(st *state, c prometheus.Collector) {
+	if !slaveAttributes.empty() {
+		metrics[newSelectedLabelsCounter("slave", "attributes", "Attributes assigned to slaves", slaveAttributes, labels...)] = func(st *state, c prometheus.Collector) {
 			for _, s := range st.Slaves {
-				slaveAttributesExport := prometheus.Labels{
-					"slave": s.PID,
-				}
-
-				// User labels
-				for _, label := range normalisedAttributeLabels {
-					slaveAttributesExport[label] = ""
-				}
-				for key, value := range s.Attributes {
-					normalisedLabel := normaliseLabel(key)
-					if stringInSlice(normalisedLabel, normalisedAttributeLabels) {
-						if attribute, err := attributeString(value); err == nil {
-							slaveAttributesExport[normalisedLabel] = attribute
-						}
-					}
+				for _, attributes := range attributeSeries(s.Attributes, explodedAttributes) {
+					c.(*selectedLabelsCounter).Set(1, attributes, s.PID)
 				}
-				c.(*settableCounterVec).Set(1, getLabelValuesFromMap(slaveAttributesExport, slaveAttributesLabelsExport)...)
 			}
 		}
 	}
 
+	// All metrics are derived from the agents, which are fetched from the
+	// smallest endpoint containing them, unless an endpoint is given.
+	if endpoint == "" {
+		endpoint = stateFieldEndpoints["slaves"]
+	}
+
 	return &masterCollector{
 		httpClient: httpClient,
 		metrics:    metrics,
+		endpoint:   endpoint,
 	}
 }
 
+// newMasterEventStateCollector returns a master state collector serving the
+// metrics from the event stream, falling back to polling while not subscribed.
+func newMasterEventStateCollector(httpClient *httpClient, endpoint string, slaveAttributes *labelSelector, explodedAttributes []string, subscriber *masterSubscriber) prometheus.Collector {
+	c := newMasterStateCollector(httpClient, endpoint, slaveAttributes, explodedAttributes).(*masterCollector)
+	c.subscriber = subscriber
+	return c
+}
+
 func (c *masterCollector) Collect(ch chan<- prometheus.Metric) {
 	var s state
-	log.WithField("url", "/state").Debug("fetching URL")
-	c.fetchAndDecode("/state", &s)
+	var synced bool
+	if c.subscriber != nil {
+		c.subscriber.Collect(ch)
+		s, synced = c.subscriber.state()
+	}
+	if synced {
+		log.Debug("serving state from event stream")
+	} else if c.operatorAPI != "" {
+		var res getAgentsResponse
+		log.WithField("call", "GET_AGENTS").Debug("calling operator API")
+		c.callOperator("GET_AGENTS", &res)
+		s = res.state()
+	} else {
+		log.WithField("url", c.endpoint).Debug("fetching URL")
+		c.fetchAndStream(c.endpoint, func(r io.Reader) error {
+			return decodeState(r, []string{"slaves"}, &s)
+		})
+	}
 
 	for c, set := range c.metrics {
 		set(&s, c)
@@ -209,11 +232,22 @@ func (c *masterCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func (c *masterCollector) Describe(ch chan<- *prometheus.Desc) {
+	if c.subscriber != nil {
+		c.subscriber.Describe(ch)
+	}
 	for metric := range c.metrics {
 		metric.Describe(ch)
 	}
 }
 
+// stateFieldEndpoints maps the fields of the master's /state to the smallest
+// endpoints containing them: the agents polled by the master state collector,
+// and the agents and frameworks fetched by the service discovery.
+var stateFieldEndpoints = map[string]string{
+	"slaves":     "/slaves",
+	"frameworks": "/frameworks",
+}
+
 type ranges [][2]uint64
 
 func (rs *ranges) UnmarshalJSON(data []byte) (err error) {
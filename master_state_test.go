@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMasterStateCollector_Endpoints(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.RequestURI())
+		w.Write([]byte(stateFixture))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		endpoint string
+		want     []string
+	}{
+		{"", []string{"/slaves"}},
+		{"/state-summary", []string{"/state-summary"}},
+		{"/state?jsonp=cb", []string{"/state?jsonp=cb"}},
+	} {
+		requested = nil
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newMasterStateCollector(&httpClient{url: srv.URL}, tt.endpoint, nil, nil))
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(requested, tt.want) {
+			t.Errorf("endpoint %q: requested %v, want %v", tt.endpoint, requested, tt.want)
+		}
+		if len(families) == 0 {
+			t.Errorf("endpoint %q: no metrics collected", tt.endpoint)
+		}
+	}
+}
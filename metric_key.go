@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyPattern matches Mesos metric names from /metrics/snapshot and extracts
+// label values from them. Patterns are "/"-separated segments, where a
+// segment is either a literal, or an optional literal prefix followed by a
+// "{label}" placeholder matching the rest of the segment. At most one
+// placeholder may be written as "{label...}" to match one or more segments,
+// so that hierarchical role names and principals containing "/" are
+// extracted whole, e.g.:
+//
+//	allocator/mesos/quota/roles/{role...}/resources/{resource}/guarantee
+//
+// matches "allocator/mesos/quota/roles/eng/web/resources/cpus/guarantee"
+// with role "eng/web" and resource "cpus".
+type keyPattern struct {
+	segments []keySegment
+	// multi is the index of the multi-segment placeholder, or -1.
+	multi int
+}
+
+type keySegment struct {
+	prefix string
+	label  string
+}
+
+func mustParseKeyPattern(pattern string) *keyPattern {
+	p, err := parseKeyPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func parseKeyPattern(pattern string) (*keyPattern, error) {
+	p := &keyPattern{multi: -1}
+	for i, s := range strings.Split(pattern, "/") {
+		open := strings.Index(s, "{")
+		if open < 0 {
+			p.segments = append(p.segments, keySegment{prefix: s})
+			continue
+		}
+		if !strings.HasSuffix(s, "}") || open+2 >= len(s) {
+			return nil, fmt.Errorf("bad placeholder in key pattern %q: %s", pattern, s)
+		}
+		label := s[open+1 : len(s)-1]
+		if strings.HasSuffix(label, "...") {
+			if p.multi >= 0 {
+				return nil, fmt.Errorf("more than one multi-segment placeholder in key pattern %q", pattern)
+			}
+			p.multi = i
+			label = strings.TrimSuffix(label, "...")
+		}
+		p.segments = append(p.segments, keySegment{prefix: s[:open], label: label})
+	}
+	return p, nil
+}
+
+// labels returns the placeholder names of the pattern in order.
+func (p *keyPattern) labels() []string {
+	labels := []string{}
+	for _, s := range p.segments {
+		if s.label != "" {
+			labels = append(labels, s.label)
+		}
+	}
+	return labels
+}
+
+// match returns the label values extracted from key in the order of
+// labels(), and whether key matched the pattern at all.
+func (p *keyPattern) match(key string) ([]string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) < len(p.segments) || (p.multi < 0 && len(parts) != len(p.segments)) {
+		return nil, false
+	}
+
+	values := make([]string, 0, len(p.segments))
+	before, after := len(p.segments), 0
+	if p.multi >= 0 {
+		before, after = p.multi, len(p.segments)-p.multi-1
+	}
+
+	for i := 0; i < before; i++ {
+		if !p.segments[i].matchSegment(parts[i], &values) {
+			return nil, false
+		}
+	}
+	if p.multi >= 0 {
+		middle := strings.Join(parts[before:len(parts)-after], "/")
+		if !p.segments[p.multi].matchSegment(middle, &values) {
+			return nil, false
+		}
+		for i := 0; i < after; i++ {
+			s := p.segments[p.multi+1+i]
+			if !s.matchSegment(parts[len(parts)-after+i], &values) {
+				return nil, false
+			}
+		}
+	}
+	return values, true
+}
+
+func (s keySegment) matchSegment(part string, values *[]string) bool {
+	if s.label == "" {
+		return part == s.prefix
+	}
+	if len(part) <= len(s.prefix) || !strings.HasPrefix(part, s.prefix) {
+		return false
+	}
+	*values = append(*values, part[len(s.prefix):])
+	return true
+}
+
+// Patterns of the snapshot metrics that carry labels in their names.
+var (
+	masterSlaveRemovalReasonKey    = mustParseKeyPattern("master/slave_removals/reason_{reason}")
+	masterTaskSourceReasonKey      = mustParseKeyPattern("master/task_{state}/source_{source}/reason_{reason}")
+	slaveTaskSourceReasonKey       = mustParseKeyPattern("slave/task_{state}/source_{source}/reason_{reason}")
+	allocatorOfferFiltersKey       = mustParseKeyPattern("allocator/mesos/offer_filters/roles/{role...}/active")
+	allocatorQuotaOfferedKey       = mustParseKeyPattern("allocator/mesos/quota/roles/{role...}/resources/{resource}/offered_or_allocated")
+	allocatorQuotaGuaranteeKey     = mustParseKeyPattern("allocator/mesos/quota/roles/{role...}/resources/{resource}/guarantee")
+	allocatorRoleSharesDominantKey = mustParseKeyPattern("allocator/mesos/roles/{role...}/shares/dominant")
+	frameworkPrincipalMessagesKey  = mustParseKeyPattern("frameworks/{framework...}/messages_{type}")
+)
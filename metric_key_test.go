@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var labeledSnapshotKeys = []*keyPattern{
+	masterSlaveRemovalReasonKey,
+	masterTaskSourceReasonKey,
+	slaveTaskSourceReasonKey,
+	allocatorOfferFiltersKey,
+	allocatorQuotaOfferedKey,
+	allocatorQuotaGuaranteeKey,
+	allocatorRoleSharesDominantKey,
+	frameworkPrincipalMessagesKey,
+}
+
+func TestParseKeyPattern(t *testing.T) {
+	for _, pattern := range []string{
+		"a/{b...}/{c...}",
+		"a/{}",
+		"a/{b",
+	} {
+		if _, err := parseKeyPattern(pattern); err == nil {
+			t.Errorf("pattern %q: expected error", pattern)
+		}
+	}
+}
+
+// TestSnapshotKeyCorpus matches the snapshot keys in testdata against all
+// label-extracting patterns. Every annotated key must match exactly one
+// pattern with the annotated labels, every other key must match none.
+func TestSnapshotKeyCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/snapshot-keys/*.txt")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no snapshot key corpus found: %v", err)
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			text := scanner.Text()
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			fields := strings.SplitN(text, "\t", 2)
+			key := fields[0]
+			want := map[string]string{}
+			if len(fields) == 2 {
+				for _, kv := range strings.Fields(fields[1]) {
+					pair := strings.SplitN(kv, "=", 2)
+					want[pair[0]] = pair[1]
+				}
+			}
+
+			got := []map[string]string{}
+			for _, p := range labeledSnapshotKeys {
+				values, ok := p.match(key)
+				if !ok {
+					continue
+				}
+				labels := map[string]string{}
+				for i, name := range p.labels() {
+					labels[name] = values[i]
+				}
+				got = append(got, labels)
+			}
+
+			switch {
+			case len(want) == 0 && len(got) != 0:
+				t.Errorf("%s:%d: %s: unexpected match %v", file, line, key, got)
+			case len(want) != 0 && len(got) != 1:
+				t.Errorf("%s:%d: %s: want exactly one match, got %v", file, line, key, got)
+			case len(want) != 0 && !reflect.DeepEqual(got[0], want):
+				t.Errorf("%s:%d: %s: got %v, want %v", file, line, key, got[0], want)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+}
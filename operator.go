@@ -0,0 +1,622 @@
+// Client for the Mesos v1 Operator HTTP API, see
+// http://mesos.apache.org/documentation/latest/operator-http-api/
+//
+// Calls are sent to the /api/v1 endpoint of masters and agents, and responses
+// are decoded either from JSON or from protobuf. The protobuf messages are
+// decoded field by field with protoReader, so only the fields used by the
+// collectors are declared below; field numbers follow
+// include/mesos/v1/{mesos,master/master,agent/agent}.proto.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Content types supported by the v1 Operator API.
+const (
+	operatorJSON     = "application/json"
+	operatorProtobuf = "application/x-protobuf"
+)
+
+// operatorCallTypes maps the call types used by the exporter to their
+// protobuf enum values in mesos.v1.master.Call and mesos.v1.agent.Call.
+var operatorCallTypes = map[string]uint64{
+	"GET_METRICS":    4,
+	"GET_STATE":      9,
+	"GET_AGENTS":     10, // master only
+	"GET_CONTAINERS": 10, // agent only
+	"SUBSCRIBE":      18, // master only
+}
+
+var (
+	valueTypes       = []string{"SCALAR", "RANGES", "SET", "TEXT"}
+	drainStateNames  = []string{"UNKNOWN", "DRAINING", "DRAINED"}
+	reservationTypes = []string{"UNKNOWN", "STATIC", "DYNAMIC"}
+)
+
+type (
+	operatorCall struct {
+		Type string `json:"type"`
+	}
+
+	// operatorResponse is implemented by the response types of the calls.
+	// The JSON representation is decoded with encoding/json.
+	operatorResponse interface {
+		unmarshalProtobuf(*protoReader)
+	}
+
+	v1ID struct {
+		Value string `json:"value"`
+	}
+	nanoseconds struct {
+		Nanoseconds int64 `json:"nanoseconds"`
+	}
+	v1Scalar struct {
+		Value float64 `json:"value"`
+	}
+	v1Ranges struct {
+		Range []struct {
+			Begin uint64 `json:"begin"`
+			End   uint64 `json:"end"`
+		} `json:"range"`
+	}
+	v1Set struct {
+		Item []string `json:"item"`
+	}
+	v1Text struct {
+		Value string `json:"value"`
+	}
+	v1Attribute struct {
+		Name   string    `json:"name"`
+		Type   string    `json:"type"`
+		Scalar *v1Scalar `json:"scalar"`
+		Ranges *v1Ranges `json:"ranges"`
+		Set    *v1Set    `json:"set"`
+		Text   *v1Text   `json:"text"`
+	}
+	v1Resource struct {
+		Name         string          `json:"name"`
+		Type         string          `json:"type"`
+		Scalar       *v1Scalar       `json:"scalar"`
+		Ranges       *v1Ranges       `json:"ranges"`
+		Role         string          `json:"role"`
+		Reservations []v1Reservation `json:"reservations"`
+		// Reservation is the dynamic reservation of a role in the format
+		// before reservation refinement (Mesos < 1.4).
+		Reservation *v1Reservation `json:"reservation"`
+	}
+	v1Reservation struct {
+		Type      string `json:"type"`
+		Role      string `json:"role"`
+		Principal string `json:"principal"`
+	}
+
+	getMetricsResponse struct {
+		GetMetrics struct {
+			Metrics []struct {
+				Name  string  `json:"name"`
+				Value float64 `json:"value"`
+			} `json:"metrics"`
+		} `json:"get_metrics"`
+	}
+
+	getAgentsResponse struct {
+		GetAgents v1GetAgents `json:"get_agents"`
+	}
+	v1GetAgents struct {
+		Agents []v1Agent `json:"agents"`
+	}
+	v1Agent struct {
+		PID       string `json:"pid"`
+		AgentInfo struct {
+			Hostname   string        `json:"hostname"`
+			ID         v1ID          `json:"id"`
+			Attributes []v1Attribute `json:"attributes"`
+		} `json:"agent_info"`
+		Active                  bool         `json:"active"`
+		Deactivated             bool         `json:"deactivated"`
+		TotalResources          []v1Resource `json:"total_resources"`
+		AllocatedResources      []v1Resource `json:"allocated_resources"`
+		DrainInfo               *drainInfo   `json:"drain_info"`
+		EstimatedDrainStartTime *nanoseconds `json:"estimated_drain_start_time"`
+	}
+	drainInfo struct {
+		State  string `json:"state"`
+		Config struct {
+			MaxGracePeriod *nanoseconds `json:"max_grace_period"`
+			MarkGone       bool         `json:"mark_gone"`
+		} `json:"config"`
+	}
+
+	getContainersResponse struct {
+		GetContainers struct {
+			Containers []v1Container `json:"containers"`
+		} `json:"get_containers"`
+	}
+	v1Container struct {
+		FrameworkID        v1ID        `json:"framework_id"`
+		ExecutorID         v1ID        `json:"executor_id"`
+		ExecutorName       string      `json:"executor_name"`
+		ContainerID        v1ID        `json:"container_id"`
+		ResourceStatistics *statistics `json:"resource_statistics"`
+	}
+)
+
+// callOperator sends a v1 Operator API call without arguments and decodes
+// the response into target, using the content type configured for the
+// client. JSON is used if none is configured.
+func (httpClient *httpClient) callOperator(call string, target operatorResponse) bool {
+	req, ok := httpClient.newOperatorRequest(call)
+	if !ok {
+		return false
+	}
+	url, contentType := req.URL.String(), req.Header.Get("Content-Type")
+
+	if contentType != operatorProtobuf {
+		return httpClient.doAndDecode(req, target)
+	}
+
+	res, ok := httpClient.do(req)
+	if !ok {
+		return false
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err == nil && res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(buf))
+	}
+	if err == nil {
+		r := newProtoReader(buf)
+		target.unmarshalProtobuf(r)
+		err = r.err
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":   url,
+			"call":  call,
+			"error": err,
+		}).Error("Error decoding response body")
+		errorCounter.Inc()
+		httpClient.health.record(url, err)
+		return false
+	}
+	return true
+}
+
+// newOperatorRequest creates the request for a v1 Operator API call without
+// arguments.
+func (httpClient *httpClient) newOperatorRequest(call string) (*http.Request, bool) {
+	url := strings.TrimSuffix(httpClient.url, "/") + "/api/v1"
+	contentType := httpClient.operatorAPI
+	if contentType == "" {
+		contentType = operatorJSON
+	}
+
+	var body []byte
+	switch contentType {
+	case operatorProtobuf:
+		body = appendProtoVarint(nil, 1, operatorCallTypes[call])
+	default:
+		body, _ = json.Marshal(&operatorCall{Type: call})
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"url":   url,
+			"error": err,
+		}).Error("Error creating HTTP request")
+		return nil, false
+	}
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Add("Accept", contentType)
+	return req, true
+}
+
+// Response field numbers shared by mesos.v1.master.Response and
+// mesos.v1.agent.Response.
+const (
+	responseGetMetrics    = 5
+	responseGetState      = 9
+	responseGetAgents     = 10 // master only
+	responseGetContainers = 10 // agent only
+)
+
+func (res *getMetricsResponse) unmarshalProtobuf(r *protoReader) {
+	for r.next() {
+		if r.field != responseGetMetrics {
+			continue
+		}
+		r.decode(func(r *protoReader) {
+			if r.field != 1 {
+				return
+			}
+			m := &res.GetMetrics.Metrics
+			*m = append(*m, struct {
+				Name  string  `json:"name"`
+				Value float64 `json:"value"`
+			}{})
+			metric := &(*m)[len(*m)-1]
+			r.decode(func(r *protoReader) {
+				switch r.field {
+				case 1:
+					metric.Name = r.string()
+				case 2:
+					metric.Value = r.double()
+				}
+			})
+		})
+	}
+}
+
+func (res *getMetricsResponse) metricMap() metricMap {
+	m := metricMap{}
+	for _, metric := range res.GetMetrics.Metrics {
+		m[metric.Name] = metric.Value
+	}
+	return m
+}
+
+func (res *getAgentsResponse) unmarshalProtobuf(r *protoReader) {
+	for r.next() {
+		if r.field == responseGetAgents {
+			r.decode(res.GetAgents.unmarshalProtobuf)
+		}
+	}
+}
+
+func (g *v1GetAgents) unmarshalProtobuf(r *protoReader) {
+	if r.field == 1 {
+		var a v1Agent
+		r.decode(a.unmarshalProtobuf)
+		g.Agents = append(g.Agents, a)
+	}
+}
+
+func (a *v1Agent) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		r.decode(func(r *protoReader) {
+			switch r.field {
+			case 1:
+				a.AgentInfo.Hostname = r.string()
+			case 5:
+				var attr v1Attribute
+				r.decode(attr.unmarshalProtobuf)
+				a.AgentInfo.Attributes = append(a.AgentInfo.Attributes, attr)
+			case 6:
+				r.decode(a.AgentInfo.ID.unmarshalProtobuf)
+			}
+		})
+	case 2:
+		a.Active = r.bool()
+	case 4:
+		a.PID = r.string()
+	case 7:
+		var res v1Resource
+		r.decode(res.unmarshalProtobuf)
+		a.TotalResources = append(a.TotalResources, res)
+	case 8:
+		var res v1Resource
+		r.decode(res.unmarshalProtobuf)
+		a.AllocatedResources = append(a.AllocatedResources, res)
+	case 12:
+		a.Deactivated = r.bool()
+	case 13:
+		a.DrainInfo = &drainInfo{}
+		r.decode(func(r *protoReader) {
+			switch r.field {
+			case 1:
+				a.DrainInfo.State = enumName(drainStateNames, r.uint())
+			case 2:
+				r.decode(func(r *protoReader) {
+					switch r.field {
+					case 1:
+						a.DrainInfo.Config.MaxGracePeriod = &nanoseconds{}
+						r.decode(a.DrainInfo.Config.MaxGracePeriod.unmarshalProtobuf)
+					case 2:
+						a.DrainInfo.Config.MarkGone = r.bool()
+					}
+				})
+			}
+		})
+	case 14:
+		a.EstimatedDrainStartTime = &nanoseconds{}
+		r.decode(a.EstimatedDrainStartTime.unmarshalProtobuf)
+	}
+}
+
+// state converts the agents to the representation of the master's /state
+// endpoint.
+func (res *getAgentsResponse) state() state {
+	var st state
+	for i := range res.GetAgents.Agents {
+		st.Slaves = append(st.Slaves, res.GetAgents.Agents[i].slave())
+	}
+	return st
+}
+
+func (a *v1Agent) slave() slave {
+	s := slave{ID: a.AgentInfo.ID.Value, Hostname: a.AgentInfo.Hostname, PID: a.PID, Attributes: map[string]json.RawMessage{}}
+	for _, r := range a.TotalResources {
+		s.Total.add(r)
+		if !r.reserved() {
+			s.Unreserved.add(r)
+		}
+	}
+	for _, r := range a.AllocatedResources {
+		s.Used.add(r)
+	}
+	for _, attr := range a.AgentInfo.Attributes {
+		s.Attributes[attr.Name] = attr.raw()
+	}
+	return s
+}
+
+func (res *getContainersResponse) unmarshalProtobuf(r *protoReader) {
+	for r.next() {
+		if r.field != responseGetContainers {
+			continue
+		}
+		r.decode(func(r *protoReader) {
+			if r.field != 1 {
+				return
+			}
+			var c v1Container
+			r.decode(func(r *protoReader) {
+				switch r.field {
+				case 1:
+					r.decode(c.FrameworkID.unmarshalProtobuf)
+				case 2:
+					r.decode(c.ExecutorID.unmarshalProtobuf)
+				case 3:
+					c.ExecutorName = r.string()
+				case 4:
+					r.decode(c.ContainerID.unmarshalProtobuf)
+				case 6:
+					c.ResourceStatistics = &statistics{}
+					r.decode(c.ResourceStatistics.unmarshalProtobuf)
+				}
+			})
+			res.GetContainers.Containers = append(res.GetContainers.Containers, c)
+		})
+	}
+}
+
+// executors converts the containers to the representation of the agent's
+// /monitor/statistics endpoint. Containers without statistics are skipped.
+func (res *getContainersResponse) executors() []executor {
+	executors := []executor{}
+	for _, c := range res.GetContainers.Containers {
+		if c.ResourceStatistics == nil {
+			continue
+		}
+		executors = append(executors, executor{
+			ID:          c.ExecutorID.Value,
+			Name:        c.ExecutorName,
+			FrameworkID: c.FrameworkID.Value,
+			Statistics:  c.ResourceStatistics,
+		})
+	}
+	return executors
+}
+
+// statisticsFields maps the fields of mesos.v1.ResourceStatistics to
+// statistics.
+var statisticsFields = map[int]func(*statistics) *float64{
+	30: func(s *statistics) *float64 { return &s.Processes },
+	31: func(s *statistics) *float64 { return &s.Threads },
+	2:  func(s *statistics) *float64 { return &s.CpusUserTimeSecs },
+	3:  func(s *statistics) *float64 { return &s.CpusSystemTimeSecs },
+	4:  func(s *statistics) *float64 { return &s.CpusLimit },
+	7:  func(s *statistics) *float64 { return &s.CpusNrPeriods },
+	8:  func(s *statistics) *float64 { return &s.CpusNrThrottled },
+	9:  func(s *statistics) *float64 { return &s.CpusThrottledTimeSecs },
+	36: func(s *statistics) *float64 { return &s.MemTotalBytes },
+	6:  func(s *statistics) *float64 { return &s.MemLimitBytes },
+	10: func(s *statistics) *float64 { return &s.MemFileBytes },
+	11: func(s *statistics) *float64 { return &s.MemAnonBytes },
+	39: func(s *statistics) *float64 { return &s.MemCacheBytes },
+	5:  func(s *statistics) *float64 { return &s.MemRssBytes },
+	12: func(s *statistics) *float64 { return &s.MemMappedFileBytes },
+	40: func(s *statistics) *float64 { return &s.MemSwapBytes },
+	41: func(s *statistics) *float64 { return &s.MemUnevictableBytes },
+	32: func(s *statistics) *float64 { return &s.MemLowPressureCounter },
+	33: func(s *statistics) *float64 { return &s.MemMediumPressureCounter },
+	34: func(s *statistics) *float64 { return &s.MemCriticalPressureCounter },
+	26: func(s *statistics) *float64 { return &s.DiskLimitBytes },
+	27: func(s *statistics) *float64 { return &s.DiskUsedBytes },
+	14: func(s *statistics) *float64 { return &s.NetRxPackets },
+	15: func(s *statistics) *float64 { return &s.NetRxBytes },
+	16: func(s *statistics) *float64 { return &s.NetRxErrors },
+	17: func(s *statistics) *float64 { return &s.NetRxDropped },
+	18: func(s *statistics) *float64 { return &s.NetTxPackets },
+	19: func(s *statistics) *float64 { return &s.NetTxBytes },
+	20: func(s *statistics) *float64 { return &s.NetTxErrors },
+	21: func(s *statistics) *float64 { return &s.NetTxDropped },
+}
+
+func (s *statistics) unmarshalProtobuf(r *protoReader) {
+	if field, ok := statisticsFields[r.field]; ok {
+		*field(s) = r.number()
+	}
+}
+
+func (id *v1ID) unmarshalProtobuf(r *protoReader) {
+	if r.field == 1 {
+		id.Value = r.string()
+	}
+}
+
+func (ns *nanoseconds) unmarshalProtobuf(r *protoReader) {
+	if r.field == 1 {
+		ns.Nanoseconds = r.int()
+	}
+}
+
+func (ns nanoseconds) seconds() float64 {
+	return float64(ns.Nanoseconds) / 1e9
+}
+
+func (s *v1Scalar) unmarshalProtobuf(r *protoReader) {
+	if r.field == 1 {
+		s.Value = r.double()
+	}
+}
+
+func (rs *v1Ranges) unmarshalProtobuf(r *protoReader) {
+	if r.field != 1 {
+		return
+	}
+	rs.Range = append(rs.Range, struct {
+		Begin uint64 `json:"begin"`
+		End   uint64 `json:"end"`
+	}{})
+	rng := &rs.Range[len(rs.Range)-1]
+	r.decode(func(r *protoReader) {
+		switch r.field {
+		case 1:
+			rng.Begin = r.uint()
+		case 2:
+			rng.End = r.uint()
+		}
+	})
+}
+
+func (rs *v1Ranges) String() string {
+	parts := []string{}
+	for _, r := range rs.Range {
+		parts = append(parts, fmt.Sprintf("%d-%d", r.Begin, r.End))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func (s *v1Set) unmarshalProtobuf(r *protoReader) {
+	if r.field == 1 {
+		s.Item = append(s.Item, r.string())
+	}
+}
+
+func (t *v1Text) unmarshalProtobuf(r *protoReader) {
+	if r.field == 1 {
+		t.Value = r.string()
+	}
+}
+
+func (a *v1Attribute) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		a.Name = r.string()
+	case 2:
+		a.Type = enumName(valueTypes, r.uint())
+	case 3:
+		a.Scalar = &v1Scalar{}
+		r.decode(a.Scalar.unmarshalProtobuf)
+	case 4:
+		a.Ranges = &v1Ranges{}
+		r.decode(a.Ranges.unmarshalProtobuf)
+	case 5:
+		a.Text = &v1Text{}
+		r.decode(a.Text.unmarshalProtobuf)
+	case 6:
+		a.Set = &v1Set{}
+		r.decode(a.Set.unmarshalProtobuf)
+	}
+}
+
+// raw returns the attribute as rendered by the master's /state endpoint.
+func (a *v1Attribute) raw() json.RawMessage {
+	var value interface{}
+	switch {
+	case a.Scalar != nil:
+		return json.RawMessage(strconv.FormatFloat(a.Scalar.Value, 'f', -1, 64))
+	case a.Ranges != nil:
+		value = a.Ranges.String()
+	case a.Set != nil:
+		value = "{" + strings.Join(a.Set.Item, ", ") + "}"
+	case a.Text != nil:
+		value = a.Text.Value
+	}
+	raw, _ := json.Marshal(value)
+	return raw
+}
+
+func (res *v1Resource) unmarshalProtobuf(r *protoReader) {
+	switch r.field {
+	case 1:
+		res.Name = r.string()
+	case 2:
+		res.Type = enumName(valueTypes, r.uint())
+	case 3:
+		res.Scalar = &v1Scalar{}
+		r.decode(res.Scalar.unmarshalProtobuf)
+	case 4:
+		res.Ranges = &v1Ranges{}
+		r.decode(res.Ranges.unmarshalProtobuf)
+	case 6:
+		res.Role = r.string()
+	case 13:
+		res.Reservations = append(res.Reservations, v1Reservation{})
+		reservation := &res.Reservations[len(res.Reservations)-1]
+		r.decode(func(r *protoReader) {
+			switch r.field {
+			case 1:
+				reservation.Principal = r.string()
+			case 3:
+				reservation.Role = r.string()
+			case 4:
+				reservation.Type = enumName(reservationTypes, r.uint())
+			}
+		})
+	}
+}
+
+// reservation returns the type and principal of the reservation of a reserved
+// resource, which is the last one if the reservation is refined.
+func (res *v1Resource) reservation() (string, string) {
+	if n := len(res.Reservations); n > 0 {
+		return res.Reservations[n-1].Type, res.Reservations[n-1].Principal
+	}
+	if res.Reservation != nil {
+		return "DYNAMIC", res.Reservation.Principal
+	}
+	return "STATIC", ""
+}
+
+// reserved reports whether the resource is statically or dynamically
+// reserved for a role.
+func (res *v1Resource) reserved() bool {
+	return len(res.Reservations) > 0 || (res.Role != "" && res.Role != "*")
+}
+
+// add adds the CPUs, memory, disk and ports of r to rs.
+func (rs *resources) add(r v1Resource) {
+	switch {
+	case r.Scalar != nil && r.Name == "cpus":
+		rs.CPUs += r.Scalar.Value
+	case r.Scalar != nil && r.Name == "mem":
+		rs.Mem += r.Scalar.Value
+	case r.Scalar != nil && r.Name == "disk":
+		rs.Disk += r.Scalar.Value
+	case r.Ranges != nil && r.Name == "ports":
+		for _, rng := range r.Ranges.Range {
+			rs.Ports = append(rs.Ports, [2]uint64{rng.Begin, rng.End})
+		}
+	}
+}
+
+func enumName(names []string, value uint64) string {
+	if value < uint64(len(names)) {
+		return names[value]
+	}
+	return strconv.FormatUint(value, 10)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const getAgentsJSON = `{
+  "type": "GET_AGENTS",
+  "get_agents": {
+    "agents": [{
+      "pid": "slave(1)@10.0.0.1:5051",
+      "agent_info": {
+        "hostname": "agent1",
+        "id": {"value": "a1"},
+        "attributes": [
+          {"name": "rack", "type": "TEXT", "text": {"value": "r1"}},
+          {"name": "ports", "type": "RANGES", "ranges": {"range": [{"begin": 1, "end": 2}, {"begin": 5, "end": 9}]}}
+        ]
+      },
+      "active": true,
+      "total_resources": [
+        {"name": "cpus", "type": "SCALAR", "scalar": {"value": 4}},
+        {"name": "cpus", "type": "SCALAR", "scalar": {"value": 2}, "reservations": [{"role": "web"}]}
+      ],
+      "allocated_resources": [
+        {"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.5}}
+      ]
+    }]
+  }
+}`
+
+func appendProtoDouble(buf []byte, field int, value float64) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3|wireFixed64)
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(value))
+	return append(buf, tmp[:]...)
+}
+
+func appendProtoString(buf []byte, field int, value string) []byte {
+	return appendProtoBytes(buf, field, []byte(value))
+}
+
+func getAgentsProtobuf() []byte {
+	cpus := func(value float64, role string) []byte {
+		res := appendProtoString(nil, 1, "cpus")
+		res = appendProtoBytes(res, 3, appendProtoDouble(nil, 1, value))
+		if role != "" {
+			res = appendProtoBytes(res, 13, appendProtoString(nil, 3, role))
+		}
+		return res
+	}
+
+	var ranges []byte
+	ranges = appendProtoBytes(ranges, 1, appendProtoVarint(appendProtoVarint(nil, 1, 1), 2, 2))
+	ranges = appendProtoBytes(ranges, 1, appendProtoVarint(appendProtoVarint(nil, 1, 5), 2, 9))
+
+	var info []byte
+	info = appendProtoString(info, 1, "agent1")
+	info = appendProtoBytes(info, 6, appendProtoString(nil, 1, "a1"))
+	info = appendProtoBytes(info, 5, appendProtoBytes(appendProtoVarint(appendProtoString(nil, 1, "rack"), 2, 3), 5, appendProtoString(nil, 1, "r1")))
+	info = appendProtoBytes(info, 5, appendProtoBytes(appendProtoVarint(appendProtoString(nil, 1, "ports"), 2, 1), 4, ranges))
+
+	var agent []byte
+	agent = appendProtoBytes(agent, 1, info)
+	agent = appendProtoVarint(agent, 2, 1)
+	agent = appendProtoString(agent, 4, "slave(1)@10.0.0.1:5051")
+	agent = appendProtoBytes(agent, 7, cpus(4, ""))
+	agent = appendProtoBytes(agent, 7, cpus(2, "web"))
+	agent = appendProtoBytes(agent, 8, cpus(1.5, ""))
+
+	return appendProtoBytes(appendProtoVarint(nil, 1, 10), 10, appendProtoBytes(nil, 1, agent))
+}
+
+func TestCallOperator_GetAgents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.Header.Get("Content-Type") {
+		case operatorProtobuf:
+			if !reflect.DeepEqual(body, appendProtoVarint(nil, 1, 10)) {
+				t.Errorf("unexpected protobuf call: %x", body)
+			}
+			w.Header().Set("Content-Type", operatorProtobuf)
+			w.Write(getAgentsProtobuf())
+		default:
+			if string(body) != `{"type":"GET_AGENTS"}` {
+				t.Errorf("unexpected JSON call: %s", body)
+			}
+			w.Write([]byte(getAgentsJSON))
+		}
+	}))
+	defer srv.Close()
+
+	want := slave{
+		ID:         "a1",
+		Hostname:   "agent1",
+		PID:        "slave(1)@10.0.0.1:5051",
+		Total:      resources{CPUs: 6},
+		Unreserved: resources{CPUs: 4},
+		Used:       resources{CPUs: 1.5},
+	}
+	wantAttributes := map[string]string{
+		"rack":  `"r1"`,
+		"ports": `"[1-2, 5-9]"`,
+	}
+
+	for _, contentType := range []string{operatorJSON, operatorProtobuf} {
+		var res getAgentsResponse
+		client := &httpClient{url: srv.URL, operatorAPI: contentType}
+		if !client.callOperator("GET_AGENTS", &res) {
+			t.Fatalf("%s: call failed", contentType)
+		}
+
+		st := res.state()
+		if len(st.Slaves) != 1 {
+			t.Fatalf("%s: got %d slaves, want 1", contentType, len(st.Slaves))
+		}
+		got := st.Slaves[0]
+		attributes := map[string]string{}
+		for name, value := range got.Attributes {
+			attributes[name] = string(value)
+		}
+		got.Attributes = nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", contentType, got, want)
+		}
+		if !reflect.DeepEqual(attributes, wantAttributes) {
+			t.Errorf("%s: got attributes %v, want %v", contentType, attributes, wantAttributes)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protobuf wire types, see
+// https://developers.google.com/protocol-buffers/docs/encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errProtobuf = errors.New("malformed protobuf message")
+
+// protoReader iterates over the fields of an encoded protobuf message. It
+// implements just enough of the wire format to decode the v1 Operator API
+// responses used by the exporter without generated code: unknown fields are
+// skipped, groups are not supported.
+type protoReader struct {
+	buf []byte
+	err error
+
+	field    int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+func newProtoReader(buf []byte) *protoReader {
+	return &protoReader{buf: buf}
+}
+
+// next advances to the next field and reports whether there is one.
+func (r *protoReader) next() bool {
+	if r.err != nil || len(r.buf) == 0 {
+		return false
+	}
+
+	key, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		return r.fail()
+	}
+	r.buf = r.buf[n:]
+	r.field, r.wireType = int(key>>3), int(key&7)
+
+	switch r.wireType {
+	case wireVarint:
+		if r.varint, n = binary.Uvarint(r.buf); n <= 0 {
+			return r.fail()
+		}
+		r.buf = r.buf[n:]
+	case wireFixed64:
+		if len(r.buf) < 8 {
+			return r.fail()
+		}
+		r.varint, r.buf = binary.LittleEndian.Uint64(r.buf), r.buf[8:]
+	case wireFixed32:
+		if len(r.buf) < 4 {
+			return r.fail()
+		}
+		r.varint, r.buf = uint64(binary.LittleEndian.Uint32(r.buf)), r.buf[4:]
+	case wireBytes:
+		size, n := binary.Uvarint(r.buf)
+		if n <= 0 || uint64(len(r.buf)-n) < size {
+			return r.fail()
+		}
+		r.bytes, r.buf = r.buf[n:n+int(size)], r.buf[n+int(size):]
+	default:
+		return r.fail()
+	}
+	return true
+}
+
+func (r *protoReader) fail() bool {
+	r.err = errProtobuf
+	return false
+}
+
+func (r *protoReader) uint() uint64 {
+	return r.varint
+}
+
+func (r *protoReader) int() int64 {
+	return int64(r.varint)
+}
+
+func (r *protoReader) bool() bool {
+	return r.varint != 0
+}
+
+func (r *protoReader) double() float64 {
+	return math.Float64frombits(r.varint)
+}
+
+// number returns the value of a numeric field of any wire type as float64.
+func (r *protoReader) number() float64 {
+	switch r.wireType {
+	case wireFixed64:
+		return r.double()
+	case wireFixed32:
+		return float64(math.Float32frombits(uint32(r.varint)))
+	}
+	return float64(r.varint)
+}
+
+func (r *protoReader) string() string {
+	return string(r.bytes)
+}
+
+// message returns a reader for the embedded message of the current field.
+func (r *protoReader) message() *protoReader {
+	return newProtoReader(r.bytes)
+}
+
+// decode calls f for every field of the embedded message of the current
+// field and propagates decoding errors to r.
+func (r *protoReader) decode(f func(*protoReader)) {
+	m := r.message()
+	for m.next() {
+		f(m)
+	}
+	if m.err != nil {
+		r.err = m.err
+	}
+}
+
+// appendProtoVarint encodes a varint field.
+func appendProtoVarint(buf []byte, field int, value uint64) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3|wireVarint)
+	return appendUvarint(buf, value)
+}
+
+// appendProtoBytes encodes a length-delimited field.
+func appendProtoBytes(buf []byte, field int, value []byte) []byte {
+	buf = appendUvarint(buf, uint64(field)<<3|wireBytes)
+	buf = appendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
@@ -0,0 +1,242 @@
+// Filtering and relabeling of the exported metrics, following the semantics of
+// Prometheus' metric_relabel_configs.
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// regex is a regular expression anchored at both ends, which can be
+	// given in the YAML configuration and as flag.
+	regex struct {
+		*regexp.Regexp
+		expr string
+	}
+
+	// relabelConfig is a relabel rule applied to the labels of every
+	// series, including the metric name as __name__.
+	relabelConfig struct {
+		SourceLabels []string `yaml:"source_labels,flow"`
+		Separator    string   `yaml:"separator"`
+		Regex        regex    `yaml:"regex"`
+		Modulus      uint64   `yaml:"modulus"`
+		TargetLabel  string   `yaml:"target_label"`
+		Replacement  string   `yaml:"replacement"`
+		Action       string   `yaml:"action"`
+	}
+)
+
+var (
+	labelNameRE  = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+	metricNameRE = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+)
+
+func newRegex(expr string) (regex, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	return regex{re, expr}, err
+}
+
+func (r *regex) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var expr string
+	if err := unmarshal(&expr); err != nil {
+		return err
+	}
+	re, err := newRegex(expr)
+	if err != nil {
+		return err
+	}
+	*r = re
+	return nil
+}
+
+func (r *regex) String() string { return r.expr }
+
+// Set sets the regex from a flag, where an empty regex leaves it unset.
+func (r *regex) Set(expr string) error {
+	if expr == "" {
+		*r = regex{}
+		return nil
+	}
+	re, err := newRegex(expr)
+	if err != nil {
+		return err
+	}
+	*r = re
+	return nil
+}
+
+// UnmarshalYAML sets the defaults of the rule before unmarshalling it.
+func (c *relabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain relabelConfig
+	*c = relabelConfig{Separator: ";", Replacement: "$1", Action: "replace"}
+	c.Regex, _ = newRegex("(.*)")
+	return unmarshal((*plain)(c))
+}
+
+func (c *relabelConfig) validate() error {
+	switch c.Action {
+	case "replace", "hashmod":
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %s requires a target label", c.Action)
+		}
+		if !labelNameRE.MatchString(c.TargetLabel) {
+			return fmt.Errorf("invalid relabel target label %q", c.TargetLabel)
+		}
+		if c.Action == "hashmod" && c.Modulus == 0 {
+			return errors.New("relabel action hashmod requires a modulus")
+		}
+	case "keep", "drop", "labeldrop":
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	if c.Regex.Regexp == nil {
+		return fmt.Errorf("relabel action %s requires a regex", c.Action)
+	}
+	return nil
+}
+
+// relabel applies the rules to labels in order. It returns false if the
+// series is dropped.
+func relabel(labels map[string]string, rules []*relabelConfig) bool {
+	for _, rule := range rules {
+		values := make([]string, len(rule.SourceLabels))
+		for i, name := range rule.SourceLabels {
+			values[i] = labels[name]
+		}
+		value := strings.Join(values, rule.Separator)
+
+		switch rule.Action {
+		case "keep":
+			if !rule.Regex.MatchString(value) {
+				return false
+			}
+		case "drop":
+			if rule.Regex.MatchString(value) {
+				return false
+			}
+		case "replace":
+			indexes := rule.Regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			if res := rule.Regex.ExpandString(nil, rule.Replacement, value, indexes); len(res) > 0 {
+				labels[rule.TargetLabel] = string(res)
+			} else {
+				delete(labels, rule.TargetLabel)
+			}
+		case "hashmod":
+			sum := md5.Sum([]byte(value))
+			labels[rule.TargetLabel] = fmt.Sprint(binary.BigEndian.Uint64(sum[8:]) % rule.Modulus)
+		case "labeldrop":
+			for name := range labels {
+				if name != "__name__" && rule.Regex.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// relabelGatherer exports only the metrics of a gatherer whose names match
+// allow and do not match deny, and relabels them. Of series which have the
+// same labels after relabeling, e.g. after a labeldrop, only the first is
+// exported and the others are counted as dropped.
+type relabelGatherer struct {
+	prometheus.Gatherer
+	allow, deny regex
+	rules       []*relabelConfig
+}
+
+func (g *relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	errs, _ := err.(prometheus.MultiError)
+	if err != nil && errs == nil {
+		errs = prometheus.MultiError{err}
+	}
+
+	families := map[string]*dto.MetricFamily{}
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string, mf *dto.MetricFamily, m *dto.Metric) {
+		family, ok := families[name]
+		if !ok {
+			family = &dto.MetricFamily{Name: proto.String(name), Help: mf.Help, Type: mf.Type}
+			families[name] = family
+			names = append(names, name)
+		}
+		if family.GetType() != mf.GetType() {
+			errs = append(errs, fmt.Errorf("relabeled metric %s of type %s collides with metric of type %s",
+				name, mf.GetType(), family.GetType()))
+			return
+		}
+		key := name + "\xff" + seriesKey(m)
+		if seen[key] {
+			log.WithFields(log.Fields{
+				"metric": name,
+				"source": mf.GetName(),
+				"labels": m.Label,
+			}).Debug("Series duplicates another series after relabeling")
+			seriesDropped.WithLabelValues(name).Inc()
+			return
+		}
+		seen[key] = true
+		family.Metric = append(family.Metric, m)
+	}
+
+	for _, mf := range mfs {
+		if g.allow.Regexp != nil && !g.allow.MatchString(mf.GetName()) ||
+			g.deny.Regexp != nil && g.deny.MatchString(mf.GetName()) {
+			continue
+		}
+		for _, m := range mf.Metric {
+			if len(g.rules) == 0 {
+				add(mf.GetName(), mf, m)
+				continue
+			}
+
+			labels := map[string]string{"__name__": mf.GetName()}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if !relabel(labels, g.rules) {
+				continue
+			}
+			name := labels["__name__"]
+			if !metricNameRE.MatchString(name) {
+				errs = append(errs, fmt.Errorf("invalid metric name %q after relabeling %s", name, mf.GetName()))
+				continue
+			}
+
+			m.Label = m.Label[:0]
+			for label, value := range labels {
+				// Labels starting with __ are reserved, and may be used as
+				// temporary labels by the rules.
+				if !strings.HasPrefix(label, "__") {
+					m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(label), Value: proto.String(value)})
+				}
+			}
+			sort.Sort(prometheus.LabelPairSorter(m.Label))
+			add(name, mf, m)
+		}
+	}
+
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		result = append(result, families[name])
+	}
+	return result, errs.MaybeUnwrap()
+}
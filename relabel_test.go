@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/yaml.v2"
+)
+
+func parseRelabelConfigs(t *testing.T, data string) []*relabelConfig {
+	var rules []*relabelConfig
+	if err := yaml.UnmarshalStrict([]byte(data), &rules); err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rules
+}
+
+func TestRelabel(t *testing.T) {
+	labels := func() map[string]string {
+		return map[string]string{"__name__": "mesos_slave_task_labels", "task_id": "app.1", "framework_id": "f1", "owner": "web"}
+	}
+
+	for _, tt := range []struct {
+		rules string
+		want  map[string]string
+	}{
+		{`[{source_labels: [owner], regex: web, action: keep}]`, labels()},
+		{`[{source_labels: [owner], regex: db, action: keep}]`, nil},
+		{`[{source_labels: [__name__, owner], regex: "mesos_slave_.*;web", action: drop}]`, nil},
+		{`[{source_labels: [task_id], regex: "(.*)\\.1", target_label: app}]`,
+			map[string]string{"__name__": "mesos_slave_task_labels", "task_id": "app.1", "framework_id": "f1", "owner": "web", "app": "app"}},
+		{`[{source_labels: [__name__], regex: "mesos_(.*)", replacement: "mesos_custom_$1", target_label: __name__}]`,
+			map[string]string{"__name__": "mesos_custom_slave_task_labels", "task_id": "app.1", "framework_id": "f1", "owner": "web"}},
+		{`[{source_labels: [missing], target_label: owner}]`,
+			map[string]string{"__name__": "mesos_slave_task_labels", "task_id": "app.1", "framework_id": "f1"}},
+		{`[{regex: ".*_id", action: labeldrop}]`,
+			map[string]string{"__name__": "mesos_slave_task_labels", "owner": "web"}},
+		{`[{source_labels: [task_id], modulus: 4, target_label: shard, action: hashmod}]`,
+			map[string]string{"__name__": "mesos_slave_task_labels", "task_id": "app.1", "framework_id": "f1", "owner": "web", "shard": "3"}},
+	} {
+		got := labels()
+		if !relabel(got, parseRelabelConfigs(t, tt.rules)) {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.rules, got, tt.want)
+		}
+	}
+
+	for _, rules := range []string{
+		`[{action: replace}]`,
+		`[{action: hashmod, target_label: shard}]`,
+		`[{action: labelmap}]`,
+		`[{target_label: "foo-bar"}]`,
+	} {
+		var rs []*relabelConfig
+		if err := yaml.UnmarshalStrict([]byte(rules), &rs); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs[0].validate(); err == nil {
+			t.Errorf("%s: expected error", rules)
+		}
+	}
+}
+
+func TestRelabelGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	tasks := gauge("slave", "task_labels", "Task labels", "task_id", "owner")
+	tasks.WithLabelValues("a", "web").Set(1)
+	tasks.WithLabelValues("b", "db").Set(1)
+	uptime := gauge("slave", "uptime_seconds", "Uptime")
+	uptime.WithLabelValues().Set(10)
+	messages := gauge("slave", "messages", "Messages")
+	messages.WithLabelValues().Set(1)
+	registry.MustRegister(tasks, uptime, messages)
+
+	allow, _ := newRegex("mesos_slave_(task_labels|uptime_seconds)")
+	deny, _ := newRegex(".*uptime.*")
+	g := &relabelGatherer{registry, allow, deny, parseRelabelConfigs(t, `
+- source_labels: [owner]
+  regex: db
+  action: drop
+- source_labels: [__name__]
+  regex: mesos_slave_(.*)
+  target_label: __name__
+  replacement: mesos_agent_$1
+`)}
+
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			got[mf.GetName()] = append(got[mf.GetName()], labelKey(m.GetLabel(), []string{"task_id", "owner"}))
+		}
+	}
+	if want := map[string][]string{"mesos_agent_task_labels": {"a/web"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRelabelGathererDuplicates(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	executors := gauge("slave", "framework_executors", "Executors", "framework_id", "role")
+	executors.WithLabelValues("f1", "web").Set(1)
+	executors.WithLabelValues("f2", "web").Set(2)
+	executors.WithLabelValues("f3", "db").Set(3)
+	registry.MustRegister(executors)
+
+	dropped := func() float64 {
+		var m dto.Metric
+		seriesDropped.WithLabelValues("mesos_slave_framework_executors").Write(&m)
+		return m.GetCounter().GetValue()
+	}
+	before := dropped()
+
+	// The series of frameworks with the same role collapse without their ID.
+	g := &relabelGatherer{Gatherer: registry, rules: parseRelabelConfigs(t, `
+- regex: framework_id
+  action: labeldrop
+`)}
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, m := range mfs[0].Metric {
+		got[labelString(m.GetLabel())] = m.GetGauge().GetValue()
+	}
+	if want := map[string]float64{"role=web": 1, "role=db": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := dropped() - before; got != 1 {
+		t.Errorf("got %v dropped series, want 1", got)
+	}
+}
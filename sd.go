@@ -0,0 +1,334 @@
+// Prometheus HTTP service discovery of the agents of the masters and of their
+// running tasks, served on /sd/agents and /sd/tasks in the http_sd format.
+// The targets are described by __meta_mesos_* labels, which can be relabeled
+// into target labels in Prometheus. The agents and tasks are fetched from the
+// masters' /slaves and /frameworks endpoints at most once per refresh
+// interval, and shared by the requests. The agents can also be written to a
+// file periodically for file_sd.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const sdLabelPrefix = "__meta_mesos_"
+
+// targetGroup is a group of targets with common labels.
+type targetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// serviceDiscovery discovers the agents and tasks of the masters.
+type serviceDiscovery struct {
+	clients []*httpClient
+	// agentPort replaces the port of the agents if not 0.
+	agentPort int
+	tasks     bool
+	// refreshInterval is the minimum interval between fetches of the
+	// masters.
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu sync.Mutex
+	// states are the states of the masters fetched at fetched.
+	states  []*state
+	fetched time.Time
+}
+
+func newServiceDiscovery(cfg *config, newClient func(url string) *httpClient) *serviceDiscovery {
+	d := &serviceDiscovery{
+		agentPort:       cfg.ServiceDiscovery.AgentPort,
+		tasks:           cfg.ServiceDiscovery.Tasks,
+		refreshInterval: cfg.ServiceDiscovery.RefreshInterval,
+		now:             time.Now,
+	}
+	for _, url := range cfg.Master {
+		d.clients = append(d.clients, newClient(url))
+	}
+	return d
+}
+
+// ServeHTTP serves the target groups of the agents, or of the tasks on
+// /sd/tasks if enabled. Nothing is served without masters.
+func (d *serviceDiscovery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(d.clients) == 0 {
+		http.Error(w, "Service discovery needs a master", http.StatusNotFound)
+		return
+	}
+
+	var tasks bool
+	switch r.URL.Path {
+	case "/sd/agents":
+	case "/sd/tasks":
+		if !d.tasks {
+			http.Error(w, "Task discovery is not enabled", http.StatusNotFound)
+			return
+		}
+		tasks = true
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	groups, err := d.targetGroups(tasks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// targetGroups returns a target group per agent, or per discovery port of the
+// running tasks. Agents and tasks known to several masters are only returned
+// once. It fails if no master could be fetched.
+func (d *serviceDiscovery) targetGroups(tasks bool) ([]*targetGroup, error) {
+	states, err := d.masterStates()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*targetGroup{}
+	seen := map[string]bool{}
+	for _, st := range states {
+		agents := map[string]*slave{}
+		for i := range st.Slaves {
+			agents[st.Slaves[i].ID] = &st.Slaves[i]
+		}
+		if !tasks {
+			for _, s := range st.Slaves {
+				if seen[s.ID] {
+					continue
+				}
+				seen[s.ID] = true
+				groups = append(groups, &targetGroup{
+					Targets: []string{d.agentTarget(&s)},
+					Labels:  agentLabels(&s),
+				})
+			}
+			continue
+		}
+
+		for _, f := range st.Frameworks {
+			for _, t := range f.Tasks {
+				agent, ok := agents[t.SlaveID]
+				if !ok || t.State != "TASK_RUNNING" || t.Discovery == nil || seen[t.FrameworkID+"/"+t.ID] {
+					continue
+				}
+				seen[t.FrameworkID+"/"+t.ID] = true
+				for _, port := range t.Discovery.Ports.Ports {
+					groups = append(groups, &targetGroup{
+						Targets: []string{net.JoinHostPort(agentHost(agent), strconv.FormatUint(uint64(port.Number), 10))},
+						Labels:  taskLabels(agent, &f, &t, &port),
+					})
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// masterStates returns the agents, and the frameworks if task discovery is
+// enabled, of the masters that could be fetched. The masters are fetched
+// again once the refresh interval has passed, and concurrent callers wait for
+// the same fetch. Failed fetches are not kept.
+func (d *serviceDiscovery) masterStates() ([]*state, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.states != nil && d.now().Sub(d.fetched) < d.refreshInterval {
+		return d.states, nil
+	}
+
+	fields := []string{"slaves"}
+	if d.tasks {
+		fields = append(fields, "frameworks")
+	}
+	states := []*state{}
+	for _, client := range d.clients {
+		st := &state{}
+		ok := true
+		for _, field := range fields {
+			ok = ok && client.fetchAndStream(stateFieldEndpoints[field], func(r io.Reader) error {
+				return decodeState(r, []string{field}, st)
+			})
+		}
+		if ok {
+			states = append(states, st)
+		}
+	}
+	if len(states) == 0 {
+		return nil, errors.New("no master could be fetched")
+	}
+	d.states, d.fetched = states, d.now()
+	return states, nil
+}
+
+// agentTarget returns the address of an agent, with the port replaced if
+// configured.
+func (d *serviceDiscovery) agentTarget(s *slave) string {
+	_, port := pidAddress(s.PID)
+	if d.agentPort != 0 {
+		port = strconv.Itoa(d.agentPort)
+	}
+	return net.JoinHostPort(agentHost(s), port)
+}
+
+// agentHost returns the hostname of an agent, or the host of its PID.
+func agentHost(s *slave) string {
+	if s.Hostname != "" {
+		return s.Hostname
+	}
+	host, _ := pidAddress(s.PID)
+	return host
+}
+
+// pidAddress returns the host and port of a libprocess PID like
+// slave(1)@10.0.0.1:5051.
+func pidAddress(pid string) (string, string) {
+	host, port, err := net.SplitHostPort(pid[strings.LastIndex(pid, "@")+1:])
+	if err != nil {
+		return "", ""
+	}
+	return host, port
+}
+
+// agentLabels returns the meta labels of an agent, with its attributes in
+// their canonical form.
+func agentLabels(s *slave) map[string]string {
+	_, port := pidAddress(s.PID)
+	labels := map[string]string{
+		sdLabelPrefix + "agent_id":       s.ID,
+		sdLabelPrefix + "agent_hostname": agentHost(s),
+		sdLabelPrefix + "agent_pid":      s.PID,
+		sdLabelPrefix + "agent_port":     port,
+	}
+	for name, raw := range s.Attributes {
+		if value, err := attributeString(raw); err == nil {
+			labels[sdLabelPrefix+"agent_attribute_"+normaliseLabel(name)] = value
+		}
+	}
+	return labels
+}
+
+// taskLabels returns the meta labels of a discovery port of a task, including
+// those of its agent.
+func taskLabels(agent *slave, f *framework, t *task, port *discoveryPort) map[string]string {
+	labels := agentLabels(agent)
+	labels[sdLabelPrefix+"framework_id"] = t.FrameworkID
+	labels[sdLabelPrefix+"framework_name"] = f.Name
+	labels[sdLabelPrefix+"task_id"] = t.ID
+	labels[sdLabelPrefix+"task_name"] = t.Name
+	labels[sdLabelPrefix+"task_port_name"] = port.Name
+	labels[sdLabelPrefix+"task_port_protocol"] = port.Protocol
+	for _, l := range t.Labels {
+		labels[sdLabelPrefix+"task_label_"+normaliseLabel(l.Key)] = l.Value
+	}
+	for _, l := range port.Labels.Labels {
+		labels[sdLabelPrefix+"task_port_label_"+normaliseLabel(l.Key)] = l.Value
+	}
+	return labels
+}
+
+// writeFile writes the target groups of the agents to a file every interval,
+// until the context is done. The file is kept if the agents cannot be fetched.
+// The agents fetched for the file are shared with the requests.
+func (d *serviceDiscovery) writeFile(ctx context.Context, file string, interval time.Duration) {
+	var previous []byte
+	for {
+		content, err := d.updateFile(file, previous)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file":  file,
+				"error": err,
+			}).Error("Error writing service discovery file")
+			errorCounter.Inc()
+		} else {
+			previous = content
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// updateFile writes the target groups of the agents to a file, unless they
+// are the previous content, and returns the content.
+func (d *serviceDiscovery) updateFile(file string, previous []byte) ([]byte, error) {
+	groups, err := d.targetGroups(false)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	if sdFileFormat(file) == "yaml" {
+		content, err = yaml.Marshal(groups)
+	} else {
+		content, err = json.MarshalIndent(groups, "", "  ")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(content, previous) {
+		return content, nil
+	}
+	return content, writeFileAtomic(file, content)
+}
+
+// sdFileFormat returns the format of a file_sd file by its extension, json or
+// yaml, or "" if it is neither.
+func sdFileFormat(file string) string {
+	switch filepath.Ext(file) {
+	case ".json":
+		return "json"
+	case ".yml", ".yaml":
+		return "yaml"
+	}
+	return ""
+}
+
+// writeFileAtomic replaces a file by renaming a temporary file in the same
+// directory, so that readers never see a partially written file. The name of
+// the temporary file does not end in the extension of the file, so that it
+// does not match the file_sd patterns.
+func writeFileAtomic(file string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
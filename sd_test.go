@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const sdSlavesFixture = `{"slaves": [
+  {"id": "a1", "hostname": "agent1", "pid": "slave(1)@10.0.0.1:5051", "attributes": {"rack": "r1", "ports": "[31000-32000]"}},
+  {"id": "a2", "pid": "slave(1)@10.0.0.2:5051"}
+]}`
+
+const sdFrameworksFixture = `{"frameworks": [{"id": "f1", "name": "marathon", "tasks": [
+  {"id": "web.1", "name": "web", "framework_id": "f1", "slave_id": "a1", "state": "TASK_RUNNING",
+   "labels": [{"key": "team.name", "value": "infra"}],
+   "discovery": {"visibility": "FRAMEWORK", "ports": {"ports": [
+     {"number": 31001, "name": "http", "protocol": "tcp", "labels": {"labels": [{"key": "metrics", "value": "/metrics"}]}}
+   ]}}},
+  {"id": "web.2", "name": "web", "framework_id": "f1", "slave_id": "a1", "state": "TASK_KILLED",
+   "discovery": {"ports": {"ports": [{"number": 31002}]}}},
+  {"id": "batch.1", "name": "batch", "framework_id": "f1", "slave_id": "a2", "state": "TASK_RUNNING"}
+]}]}`
+
+// newFakeMaster returns a master serving the fixtures, which counts the
+// requests of each path in requests.
+func newFakeMaster(requests map[string]int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/slaves":
+			w.Write([]byte(sdSlavesFixture))
+		case "/frameworks":
+			w.Write([]byte(sdFrameworksFixture))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestServiceDiscovery(t *testing.T) {
+	master := newFakeMaster(map[string]int{})
+	defer master.Close()
+
+	cfg := &config{}
+	// Agents known to both masters are only returned once.
+	cfg.Master = targets{master.URL, master.URL}
+	cfg.ServiceDiscovery.AgentPort = 9105
+	d := newServiceDiscovery(cfg, func(url string) *httpClient { return &httpClient{url: url} })
+
+	get := func(path string) (int, []*targetGroup) {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var groups []*targetGroup
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&groups); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, groups
+	}
+
+	code, agents := get("/sd/agents")
+	wantAgents := []*targetGroup{{
+		Targets: []string{"agent1:9105"},
+		Labels: map[string]string{
+			"__meta_mesos_agent_id":              "a1",
+			"__meta_mesos_agent_hostname":        "agent1",
+			"__meta_mesos_agent_pid":             "slave(1)@10.0.0.1:5051",
+			"__meta_mesos_agent_port":            "5051",
+			"__meta_mesos_agent_attribute_rack":  "r1",
+			"__meta_mesos_agent_attribute_ports": "[31000-32000]",
+		},
+	}, {
+		Targets: []string{"10.0.0.2:9105"},
+		Labels: map[string]string{
+			"__meta_mesos_agent_id":       "a2",
+			"__meta_mesos_agent_hostname": "10.0.0.2",
+			"__meta_mesos_agent_pid":      "slave(1)@10.0.0.2:5051",
+			"__meta_mesos_agent_port":     "5051",
+		},
+	}}
+	if code != http.StatusOK || !reflect.DeepEqual(agents, wantAgents) {
+		t.Errorf("got agents %d %+v, want %+v", code, agents, wantAgents)
+	}
+
+	if code, _ := get("/sd/tasks"); code != http.StatusNotFound {
+		t.Errorf("got status %d for disabled task discovery, want 404", code)
+	}
+	d.tasks = true
+	code, tasks := get("/sd/tasks")
+	wantTasks := []*targetGroup{{
+		Targets: []string{"agent1:31001"},
+		Labels: map[string]string{
+			"__meta_mesos_agent_id":                "a1",
+			"__meta_mesos_agent_hostname":          "agent1",
+			"__meta_mesos_agent_pid":               "slave(1)@10.0.0.1:5051",
+			"__meta_mesos_agent_port":              "5051",
+			"__meta_mesos_agent_attribute_rack":    "r1",
+			"__meta_mesos_agent_attribute_ports":   "[31000-32000]",
+			"__meta_mesos_framework_id":            "f1",
+			"__meta_mesos_framework_name":          "marathon",
+			"__meta_mesos_task_id":                 "web.1",
+			"__meta_mesos_task_name":               "web",
+			"__meta_mesos_task_port_name":          "http",
+			"__meta_mesos_task_port_protocol":      "tcp",
+			"__meta_mesos_task_label_team_name":    "infra",
+			"__meta_mesos_task_port_label_metrics": "/metrics",
+		},
+	}}
+	if code != http.StatusOK || !reflect.DeepEqual(tasks, wantTasks) {
+		t.Errorf("got tasks %d %+v, want %+v", code, tasks, wantTasks)
+	}
+
+	// Prometheus keeps the previous targets if no master can be fetched.
+	master.Close()
+	if code, _ := get("/sd/agents"); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d without masters, want 503", code)
+	}
+}
+
+func TestServiceDiscoveryCache(t *testing.T) {
+	requests := map[string]int{}
+	master := newFakeMaster(requests)
+	defer master.Close()
+
+	cfg := &config{}
+	cfg.Master = targets{master.URL}
+	cfg.ServiceDiscovery.Tasks = true
+	cfg.ServiceDiscovery.RefreshInterval = time.Minute
+	d := newServiceDiscovery(cfg, func(url string) *httpClient { return &httpClient{url: url} })
+	now := time.Unix(0, 0)
+	d.now = func() time.Time { return now }
+
+	// The agents and tasks are fetched once per refresh interval.
+	for i := 0; i < 3; i++ {
+		for _, tasks := range []bool{false, true} {
+			if _, err := d.targetGroups(tasks); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if want := map[string]int{"/slaves": 1, "/frameworks": 1}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests %v, want %v", requests, want)
+	}
+	now = now.Add(time.Minute)
+	if _, err := d.targetGroups(false); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"/slaves": 2, "/frameworks": 2}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests %v after the refresh interval, want %v", requests, want)
+	}
+
+	// Without masters, e.g. for agents only, nothing is served.
+	d = newServiceDiscovery(&config{}, func(url string) *httpClient { return &httpClient{url: url} })
+	for _, path := range []string{"/sd/agents", "/sd/tasks"} {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d without masters, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestServiceDiscoveryFile(t *testing.T) {
+	requests := map[string]int{}
+	master := newFakeMaster(requests)
+	defer master.Close()
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config{}
+	cfg.Master = targets{master.URL}
+	cfg.ServiceDiscovery.AgentPort = 9105
+	d := newServiceDiscovery(cfg, func(url string) *httpClient { return &httpClient{url: url} })
+	want, err := d.targetGroups(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"agents.json", "agents.yml"} {
+		file := filepath.Join(dir, name)
+		content, err := d.updateFile(file, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		written, err := ioutil.ReadFile(file)
+		if err != nil || !bytes.Equal(written, content) {
+			t.Fatalf("%s: got %q, error %v, want %q", name, written, err, content)
+		}
+		var groups []*targetGroup
+		if err := yaml.Unmarshal(written, &groups); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(groups, want) {
+			t.Errorf("%s: got %+v, want %+v", name, groups, want)
+		}
+	}
+
+	// The file updates and the requests within the refresh interval share
+	// the previous fetch.
+	d.refreshInterval = time.Hour
+	fetched := requests["/slaves"]
+	for i := 0; i < 2; i++ {
+		if _, err := d.updateFile(filepath.Join(dir, "agents.json"), nil); err != nil {
+			t.Fatal(err)
+		}
+		d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/sd/agents", nil))
+	}
+	if got := requests["/slaves"] - fetched; got != 0 {
+		t.Errorf("got %d more requests of /slaves within the refresh interval, want 0", got)
+	}
+	d.refreshInterval = 0
+
+	// Failed updates keep the file, and no temporary files are left.
+	file := filepath.Join(dir, "agents.json")
+	before, _ := ioutil.ReadFile(file)
+	master.Close()
+	if _, err := d.updateFile(file, nil); err == nil {
+		t.Error("expected error without masters")
+	}
+	if after, _ := ioutil.ReadFile(file); !bytes.Equal(after, before) {
+		t.Errorf("got %q after failed update, want %q", after, before)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	hidden, _ := filepath.Glob(filepath.Join(dir, ".*"))
+	if len(files) != 2 || len(hidden) != 0 {
+		t.Errorf("got files %v %v, want only the service discovery files", files, hidden)
+	}
+}
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"fmt"
-	"regexp"
-
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -345,24 +342,10 @@ func newSlaveCollector(httpClient *httpClient) prometheus.Collector {
 		},
 
 		counter("slave", "task_state_counts_by_source_reason", "Number of task states by source and reason", "state", "source", "reason"): func(m metricMap, c prometheus.Collector) error {
-			re, err := regexp.Compile("slave/task_(.*?)/source_(.*?)/reason_(.*?)$")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"regex":  "slave/task_(.*?)/source_(.*?)/reason_(.*?)$",
-					"metric": "slave_task_state_counts_by_source_reason",
-					"error":  err,
-				}).Error("could not compile regex")
-				return fmt.Errorf("could not compile slave_task_state_counts_by_source_reason regex: %s", err)
-			}
 			for metric, value := range m {
-				matches := re.FindStringSubmatch(metric)
-				if len(matches) != 4 {
-					continue
+				if labels, ok := slaveTaskSourceReasonKey.match(metric); ok {
+					c.(*settableCounterVec).Set(value, labels...)
 				}
-				state := matches[1]
-				source := matches[2]
-				reason := matches[3]
-				c.(*settableCounterVec).Set(value, state, source, reason)
 			}
 			return nil
 		},
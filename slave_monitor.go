@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 )
 
 type (
@@ -235,7 +236,14 @@ func newSlaveMonitorCollector(httpClient *httpClient) prometheus.Collector {
 
 func (c *slaveCollector) Collect(ch chan<- prometheus.Metric) {
 	stats := []executor{}
-	c.fetchAndDecode("/monitor/statistics", &stats)
+	if c.operatorAPI != "" {
+		var res getContainersResponse
+		log.WithField("call", "GET_CONTAINERS").Debug("calling operator API")
+		c.callOperator("GET_CONTAINERS", &res)
+		stats = res.executors()
+	} else {
+		c.fetchAndDecode("/monitor/statistics", &stats)
+	}
 
 	for _, exec := range stats {
 		for desc, m := range c.metrics {
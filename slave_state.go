@@ -3,10 +3,14 @@
 //
 // * Labels of running tasks ("mesos_slave_task_labels" series)
 // * Attributes of mesos slaves ("mesos_slave_attributes")
+// * Frameworks and executors ("mesos_slave_framework_*", "mesos_slave_executor_*")
+// * Total, used, unreserved and reserved resources ("mesos_slave_mem_bytes" etc.)
+// * Reservations by type and principal ("mesos_slave_reserved_resources")
 package main
 
 import (
 	"encoding/json"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
@@ -14,23 +18,43 @@ import (
 
 type (
 	slaveState struct {
+		PID        string                     `json:"pid"`
 		Attributes map[string]json.RawMessage `json:"attributes"`
 		Frameworks []slaveFramework           `json:"frameworks"`
+		Total      resources                  `json:"resources"`
+		Reserved   map[string]resources       `json:"reserved_resources"`
+		Unreserved resources                  `json:"unreserved_resources"`
+		// ReservedFull are the reserved resources by role with their
+		// reservations.
+		ReservedFull map[string][]v1Resource `json:"reserved_resources_full"`
 	}
 	slaveFramework struct {
-		ID        string               `json:"ID"`
-		Executors []slaveStateExecutor `json:"executors"`
+		ID                 string               `json:"ID"`
+		Name               string               `json:"name"`
+		User               string               `json:"user"`
+		Role               string               `json:"role"`
+		Roles              []string             `json:"roles"`
+		Executors          []slaveStateExecutor `json:"executors"`
+		CompletedExecutors []slaveStateExecutor `json:"completed_executors"`
 	}
 	slaveStateExecutor struct {
-		ID     string `json:"id"`
-		Name   string `json:"name"`
-		Source string `json:"source"`
-		Tasks  []task `json:"tasks"`
+		ID             string    `json:"id"`
+		Name           string    `json:"name"`
+		Source         string    `json:"source"`
+		Container      string    `json:"container"`
+		Directory      string    `json:"directory"`
+		Resources      resources `json:"resources"`
+		Tasks          []task    `json:"tasks"`
+		QueuedTasks    []task    `json:"queued_tasks"`
+		CompletedTasks []task    `json:"completed_tasks"`
 	}
 
 	slaveStateCollector struct {
 		*httpClient
 		metrics map[*prometheus.Desc]slaveMetric
+		// selected are the metrics with labels selected from task labels
+		// or agent attributes.
+		selected map[*selectedLabelsCounter]func(*slaveState, *selectedLabelsCounter)
 	}
 	slaveMetric struct {
 		valueType prometheus.ValueType
@@ -42,82 +66,284 @@ type (
 	}
 )
 
-func newSlaveStateCollector(httpClient *httpClient, userTaskLabelList []string, slaveAttributeLabelList []string) *slaveStateCollector {
-	c := slaveStateCollector{httpClient, make(map[*prometheus.Desc]slaveMetric)}
+// defaultTaskLabels are the labels of "mesos_slave_task_labels" in addition
+// to the selected task labels.
+var defaultTaskLabels = []string{"source", "framework_id", "executor_id", "task_id", "task_name"}
 
-	defaultTaskLabels := []string{"source", "framework_id", "executor_id", "task_id", "task_name"}
-	normalisedUserTaskLabelList := normaliseLabelList(userTaskLabelList)
-	taskLabelList := append(defaultTaskLabels, normalisedUserTaskLabelList...)
+func newSlaveStateCollector(httpClient *httpClient, taskLabels, slaveAttributes *labelSelector, explodedAttributes []string) *slaveStateCollector {
+	c := slaveStateCollector{
+		httpClient,
+		make(map[*prometheus.Desc]slaveMetric),
+		make(map[*selectedLabelsCounter]func(*slaveState, *selectedLabelsCounter)),
+	}
 
-	c.metrics[prometheus.NewDesc(
-		prometheus.BuildFQName("mesos", "slave", "task_labels"),
-		"Labels assigned to tasks running on slaves",
-		taskLabelList,
-		nil)] = slaveMetric{prometheus.CounterValue,
-		func(st *slaveState) []metricValue {
-			res := []metricValue{}
+	c.selected[newSelectedLabelsCounter("slave", "task_labels", "Labels assigned to tasks running on slaves", taskLabels, defaultTaskLabels...)] =
+		func(st *slaveState, m *selectedLabelsCounter) {
 			for _, f := range st.Frameworks {
 				for _, e := range f.Executors {
 					for _, t := range e.Tasks {
-						//Default labels
-						taskLabels := prometheus.Labels{
-							"source":       e.Source,
-							"framework_id": f.ID,
-							"executor_id":  e.ID,
-							"task_id":      t.ID,
-							"task_name":    t.Name,
-						}
-
-						// User labels
-						for _, label := range normalisedUserTaskLabelList {
-							taskLabels[label] = ""
-						}
+						labels := map[string]string{}
 						for _, label := range t.Labels {
-							normalisedLabel := normaliseLabel(label.Key)
-							// Ignore labels not explicitly whitelisted by user
-							if stringInSlice(normalisedLabel, normalisedUserTaskLabelList) {
-								taskLabels[normalisedLabel] = label.Value
-							}
+							labels[label.Key] = label.Value
 						}
-
-						res = append(res, metricValue{1, getLabelValuesFromMap(taskLabels, taskLabelList)})
+						m.Set(1, labels, e.Source, f.ID, e.ID, t.ID, t.Name)
 					}
 				}
 			}
+		}
+
+	frameworkLabels := []string{"framework_id"}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "framework_info"),
+		"Information about frameworks with executors on the slave",
+		[]string{"framework_id", "framework_name", "role", "user"},
+		nil)] = slaveMetric{prometheus.CounterValue,
+		func(st *slaveState) []metricValue {
+			res := []metricValue{}
+			for _, f := range st.Frameworks {
+				res = append(res, metricValue{1, []string{f.ID, f.Name, f.role(), f.User}})
+			}
+			return res
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "framework_executors"),
+		"Current number of executors per framework on the slave",
+		frameworkLabels,
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			res := []metricValue{}
+			for _, f := range st.Frameworks {
+				res = append(res, metricValue{float64(len(f.Executors)), []string{f.ID}})
+			}
+			return res
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "framework_completed_executors"),
+		"Number of completed executors per framework retained by the slave",
+		frameworkLabels,
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			res := []metricValue{}
+			for _, f := range st.Frameworks {
+				res = append(res, metricValue{float64(len(f.CompletedExecutors)), []string{f.ID}})
+			}
+			return res
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "framework_completed_tasks"),
+		"Number of completed tasks per framework retained by the slave",
+		frameworkLabels,
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			res := []metricValue{}
+			for _, f := range st.Frameworks {
+				var completed int
+				for _, e := range f.Executors {
+					completed += len(e.CompletedTasks)
+				}
+				for _, e := range f.CompletedExecutors {
+					completed += len(e.CompletedTasks)
+				}
+				res = append(res, metricValue{float64(completed), []string{f.ID}})
+			}
 			return res
 		},
 	}
 
-	if len(slaveAttributeLabelList) > 0 {
-		normalisedAttributeLabels := normaliseLabelList(slaveAttributeLabelList)
+	executorLabels := []string{"framework_id", "executor_id", "source"}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "executor_info"),
+		"Information about executors running on the slave",
+		[]string{"framework_id", "executor_id", "executor_name", "source", "container", "directory"},
+		nil)] = slaveMetric{prometheus.CounterValue,
+		func(st *slaveState) []metricValue {
+			res := []metricValue{}
+			for _, f := range st.Frameworks {
+				for _, e := range f.Executors {
+					res = append(res, metricValue{1, []string{f.ID, e.ID, e.Name, e.Source, e.Container, e.Directory}})
+				}
+			}
+			return res
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "executor_cpus"),
+		"Executor CPUs (fractional)",
+		executorLabels,
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			return executorValues(st, func(e *slaveStateExecutor) float64 { return e.Resources.CPUs })
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "executor_mem_bytes"),
+		"Executor memory in bytes",
+		executorLabels,
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			return executorValues(st, func(e *slaveStateExecutor) float64 { return e.Resources.Mem * 1024 * 1024 })
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "executor_disk_bytes"),
+		"Executor disk space in bytes",
+		executorLabels,
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			return executorValues(st, func(e *slaveStateExecutor) float64 { return e.Resources.Disk * 1024 * 1024 })
+		},
+	}
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "executor_tasks"),
+		"Current number of tasks per executor by state",
+		append(executorLabels, "state"),
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			res := []metricValue{}
+			for _, f := range st.Frameworks {
+				for _, e := range f.Executors {
+					res = append(res,
+						metricValue{float64(len(e.QueuedTasks)), []string{f.ID, e.ID, e.Source, "queued"}},
+						metricValue{float64(len(e.Tasks)), []string{f.ID, e.ID, e.Source, "launched"}},
+						metricValue{float64(len(e.CompletedTasks)), []string{f.ID, e.ID, e.Source, "completed"}},
+					)
+				}
+			}
+			return res
+		},
+	}
 
+	for _, r := range []struct {
+		name, unit, help string
+		// total is the name of the metric of the total resources.
+		total string
+		value func(resources) float64
+	}{
+		// The snapshot exports mesos_slave_cpus{type}, which the total CPUs
+		// would collide with.
+		{"cpus", "", "slave CPUs (fractional)", "cpus_total", func(r resources) float64 { return r.CPUs }},
+		{"mem", "_bytes", "slave memory in bytes", "mem_bytes", func(r resources) float64 { return r.Mem * 1024 * 1024 }},
+		{"disk", "_bytes", "slave disk space in bytes", "disk_bytes", func(r resources) float64 { return r.Disk * 1024 * 1024 }},
+		{"ports", "", "slave ports", "ports", func(r resources) float64 { return float64(r.Ports.size()) }},
+	} {
+		value := r.value
 		c.metrics[prometheus.NewDesc(
-			prometheus.BuildFQName("mesos", "slave", "attributes"),
-			"Attributes assigned to slaves",
-			normalisedAttributeLabels,
-			nil)] = slaveMetric{prometheus.CounterValue,
+			prometheus.BuildFQName("mesos", "slave", r.total),
+			"Total "+r.help,
+			[]string{"slave"},
+			nil)] = slaveMetric{prometheus.GaugeValue,
 			func(st *slaveState) []metricValue {
-				slaveAttributes := prometheus.Labels{}
-
-				for _, label := range normalisedAttributeLabels {
-					slaveAttributes[label] = ""
+				return []metricValue{{value(st.Total), []string{st.PID}}}
+			},
+		}
+		c.metrics[prometheus.NewDesc(
+			prometheus.BuildFQName("mesos", "slave", r.name+"_used"+r.unit),
+			"Used "+r.help,
+			[]string{"slave"},
+			nil)] = slaveMetric{prometheus.GaugeValue,
+			func(st *slaveState) []metricValue {
+				return []metricValue{{value(st.used()), []string{st.PID}}}
+			},
+		}
+		c.metrics[prometheus.NewDesc(
+			prometheus.BuildFQName("mesos", "slave", r.name+"_unreserved"+r.unit),
+			"Unreserved "+r.help,
+			[]string{"slave"},
+			nil)] = slaveMetric{prometheus.GaugeValue,
+			func(st *slaveState) []metricValue {
+				return []metricValue{{value(st.Unreserved), []string{st.PID}}}
+			},
+		}
+		c.metrics[prometheus.NewDesc(
+			prometheus.BuildFQName("mesos", "slave", r.name+"_reserved"+r.unit),
+			"Reserved "+r.help+" by role",
+			[]string{"slave", "role"},
+			nil)] = slaveMetric{prometheus.GaugeValue,
+			func(st *slaveState) []metricValue {
+				res := []metricValue{}
+				for role, reserved := range st.Reserved {
+					res = append(res, metricValue{value(reserved), []string{st.PID, role}})
 				}
-				for key, value := range st.Attributes {
-					normalisedLabel := normaliseLabel(key)
-					if stringInSlice(normalisedLabel, normalisedAttributeLabels) {
-						if attribute, err := attributeString(value); err == nil {
-							slaveAttributes[normalisedLabel] = attribute
-						}
+				return res
+			},
+		}
+	}
+
+	c.metrics[prometheus.NewDesc(
+		prometheus.BuildFQName("mesos", "slave", "reserved_resources"),
+		"Reserved scalar slave resources by role, reservation type and principal, in Mesos units (MB for mem and disk)",
+		[]string{"slave", "role", "resource", "type", "principal"},
+		nil)] = slaveMetric{prometheus.GaugeValue,
+		func(st *slaveState) []metricValue {
+			type key struct{ role, resource, typ, principal string }
+			reserved := map[key]float64{}
+			for role, resources := range st.ReservedFull {
+				for i := range resources {
+					r := &resources[i]
+					if r.Scalar == nil {
+						continue
 					}
+					typ, principal := r.reservation()
+					reserved[key{role, r.Name, typ, principal}] += r.Scalar.Value
 				}
+			}
+			res := []metricValue{}
+			for k, v := range reserved {
+				res = append(res, metricValue{v, []string{st.PID, k.role, k.resource, k.typ, k.principal}})
+			}
+			return res
+		},
+	}
 
-				return []metricValue{{1, getLabelValuesFromMap(slaveAttributes, normalisedAttributeLabels)}}
-			},
-		}
+	if !slaveAttributes.empty() {
+		c.selected[newSelectedLabelsCounter("slave", "attributes", "Attributes assigned to slaves", slaveAttributes)] =
+			func(st *slaveState, m *selectedLabelsCounter) {
+				for _, attributes := range attributeSeries(st.Attributes, explodedAttributes) {
+					m.Set(1, attributes)
+				}
+			}
 	}
 	return &c
 }
 
+// role returns the role of the framework. Multi-role frameworks report their
+// roles comma-separated.
+func (f *slaveFramework) role() string {
+	if len(f.Roles) > 0 {
+		return strings.Join(f.Roles, ",")
+	}
+	return f.Role
+}
+
+// used returns the resources allocated to the executors running on the slave.
+func (st *slaveState) used() resources {
+	var used resources
+	for _, f := range st.Frameworks {
+		for _, e := range f.Executors {
+			used.CPUs += e.Resources.CPUs
+			used.Mem += e.Resources.Mem
+			used.Disk += e.Resources.Disk
+			used.Ports = append(used.Ports, e.Resources.Ports...)
+		}
+	}
+	return used
+}
+
+// executorValues returns one value per running executor on the slave.
+func executorValues(st *slaveState, get func(*slaveStateExecutor) float64) []metricValue {
+	res := []metricValue{}
+	for _, f := range st.Frameworks {
+		for i := range f.Executors {
+			e := &f.Executors[i]
+			res = append(res, metricValue{get(e), []string{f.ID, e.ID, e.Source}})
+		}
+	}
+	return res
+}
+
 func (c *slaveStateCollector) Collect(ch chan<- prometheus.Metric) {
 	var s slaveState
 	log.WithField("url", "/slave(1)/state").Debug("fetching URL")
@@ -127,10 +353,17 @@ func (c *slaveStateCollector) Collect(ch chan<- prometheus.Metric) {
 			ch <- prometheus.MustNewConstMetric(d, cm.valueType, m.result, m.labels...)
 		}
 	}
+	for m, set := range c.selected {
+		set(&s, m)
+		m.Collect(ch)
+	}
 }
 
 func (c *slaveStateCollector) Describe(ch chan<- *prometheus.Desc) {
 	for d := range c.metrics {
 		ch <- d
 	}
+	for m := range c.selected {
+		m.Describe(ch)
+	}
 }
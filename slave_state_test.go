@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const slaveStateFixture = `{
+  "id": "a1", "pid": "slave(1)@10.0.0.1:5051", "hostname": "agent1",
+  "resources": {"cpus": 8.0, "disk": 10240.0, "gpus": 0.0, "mem": 16384.0, "ports": "[31000-31099]"},
+  "reserved_resources": {
+    "web": {"cpus": 2.0, "disk": 1024.0, "gpus": 0.0, "mem": 4096.0, "ports": "[31000-31009]"},
+    "batch": {"cpus": 1.0, "disk": 0.0, "gpus": 0.0, "mem": 0.0}
+  },
+  "unreserved_resources": {"cpus": 5.0, "disk": 9216.0, "gpus": 0.0, "mem": 12288.0, "ports": "[31010-31099]"},
+  "reserved_resources_full": {
+    "web": [
+      {"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.0}, "role": "web",
+       "reservations": [{"type": "STATIC", "role": "web"}]},
+      {"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.0}, "role": "web",
+       "reservations": [{"type": "DYNAMIC", "role": "web", "principal": "ops"}]},
+      {"name": "mem", "type": "SCALAR", "scalar": {"value": 4096.0}, "role": "web",
+       "reservations": [{"type": "DYNAMIC", "role": "web", "principal": "ops"}]},
+      {"name": "disk", "type": "SCALAR", "scalar": {"value": 1024.0}, "role": "web",
+       "reservations": [{"type": "DYNAMIC", "role": "web", "principal": "ops"}],
+       "disk": {"persistence": {"id": "v1", "principal": "ops"}, "volume": {"mode": "RW", "container_path": "data"}}},
+      {"name": "ports", "type": "RANGES", "ranges": {"range": [{"begin": 31000, "end": 31009}]}, "role": "web",
+       "reservations": [{"type": "STATIC", "role": "web"}]}
+    ],
+    "batch": [
+      {"name": "cpus", "type": "SCALAR", "scalar": {"value": 1.0}, "role": "batch",
+       "reservation": {"principal": "batch-scheduler"}}
+    ]
+  },
+  "frameworks": [
+    {"id": "f1", "name": "marathon", "user": "root", "role": "web",
+     "executors": [
+       {"id": "web.1", "name": "Command Executor", "source": "web.1", "container": "c1",
+        "directory": "/var/lib/mesos/slaves/a1/frameworks/f1/executors/web.1/runs/c1",
+        "resources": {"cpus": 1.1, "disk": 0.0, "mem": 160.0, "ports": "[31000-31000]"},
+        "tasks": [{"id": "web.1", "name": "web", "framework_id": "f1", "executor_id": "", "state": "TASK_RUNNING"}],
+        "queued_tasks": [],
+        "completed_tasks": [{"id": "web.0", "name": "web", "framework_id": "f1", "state": "TASK_FAILED"}]}
+     ],
+     "completed_executors": [
+       {"id": "web.0", "name": "Command Executor", "source": "web.0", "container": "c0",
+        "resources": {"cpus": 1.1, "mem": 160.0}, "tasks": [], "queued_tasks": [],
+        "completed_tasks": [{"id": "web.0", "name": "web", "framework_id": "f1", "state": "TASK_FAILED"}]}
+     ]},
+    {"id": "f2", "name": "spark", "user": "spark", "roles": ["batch", "batch/adhoc"],
+     "executors": [
+       {"id": "driver", "name": "", "source": "spark", "container": "c2",
+        "resources": {"cpus": 0.5, "disk": 100.0, "mem": 64.0},
+        "tasks": [],
+        "queued_tasks": [{"id": "job.1", "name": "job", "framework_id": "f2", "state": "TASK_STAGING"}],
+        "completed_tasks": []}
+     ]}
+  ]
+}`
+
+func newSlaveStateServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/slave(1)/state" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(slaveStateFixture))
+	}))
+}
+
+func TestSlaveStateCollector_Resources(t *testing.T) {
+	srv := newSlaveStateServer()
+	defer srv.Close()
+
+	got := map[string]float64{}
+	for name, value := range gatherValues(t, newSlaveStateCollector(&httpClient{url: srv.URL}, nil, nil, nil)) {
+		if !strings.HasPrefix(name, "mesos_slave_framework") && !strings.HasPrefix(name, "mesos_slave_executor") &&
+			!strings.HasPrefix(name, "mesos_slave_task") {
+			got[name] = value
+		}
+	}
+	pid := "slave=slave(1)@10.0.0.1:5051"
+	want := map[string]float64{
+		"mesos_slave_cpus_total{" + pid + "}": 8,
+		"mesos_slave_mem_bytes{" + pid + "}":  16384 * 1024 * 1024,
+		"mesos_slave_disk_bytes{" + pid + "}": 10240 * 1024 * 1024,
+		"mesos_slave_ports{" + pid + "}":      100,
+
+		"mesos_slave_cpus_used{" + pid + "}":       1.6,
+		"mesos_slave_mem_used_bytes{" + pid + "}":  224 * 1024 * 1024,
+		"mesos_slave_disk_used_bytes{" + pid + "}": 100 * 1024 * 1024,
+		"mesos_slave_ports_used{" + pid + "}":      1,
+
+		"mesos_slave_cpus_unreserved{" + pid + "}":       5,
+		"mesos_slave_mem_unreserved_bytes{" + pid + "}":  12288 * 1024 * 1024,
+		"mesos_slave_disk_unreserved_bytes{" + pid + "}": 9216 * 1024 * 1024,
+		"mesos_slave_ports_unreserved{" + pid + "}":      90,
+
+		"mesos_slave_cpus_reserved{role=web," + pid + "}":         2,
+		"mesos_slave_cpus_reserved{role=batch," + pid + "}":       1,
+		"mesos_slave_mem_reserved_bytes{role=web," + pid + "}":    4096 * 1024 * 1024,
+		"mesos_slave_mem_reserved_bytes{role=batch," + pid + "}":  0,
+		"mesos_slave_disk_reserved_bytes{role=web," + pid + "}":   1024 * 1024 * 1024,
+		"mesos_slave_disk_reserved_bytes{role=batch," + pid + "}": 0,
+		"mesos_slave_ports_reserved{role=web," + pid + "}":        10,
+		"mesos_slave_ports_reserved{role=batch," + pid + "}":      0,
+
+		"mesos_slave_reserved_resources{principal=,resource=cpus,role=web," + pid + ",type=STATIC}":                   1,
+		"mesos_slave_reserved_resources{principal=ops,resource=cpus,role=web," + pid + ",type=DYNAMIC}":               1,
+		"mesos_slave_reserved_resources{principal=ops,resource=mem,role=web," + pid + ",type=DYNAMIC}":                4096,
+		"mesos_slave_reserved_resources{principal=ops,resource=disk,role=web," + pid + ",type=DYNAMIC}":               1024,
+		"mesos_slave_reserved_resources{principal=batch-scheduler,resource=cpus,role=batch," + pid + ",type=DYNAMIC}": 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSlaveStateCollector_Frameworks(t *testing.T) {
+	srv := newSlaveStateServer()
+	defer srv.Close()
+
+	got := map[string]float64{}
+	for name, value := range gatherValues(t, newSlaveStateCollector(&httpClient{url: srv.URL}, nil, nil, nil)) {
+		if strings.HasPrefix(name, "mesos_slave_framework") || strings.HasPrefix(name, "mesos_slave_executor") {
+			got[name] = value
+		}
+	}
+	web := "executor_id=web.1,framework_id=f1,source=web.1"
+	driver := "executor_id=driver,framework_id=f2,source=spark"
+	want := map[string]float64{
+		"mesos_slave_framework_info{framework_id=f1,framework_name=marathon,role=web,user=root}":             1,
+		"mesos_slave_framework_info{framework_id=f2,framework_name=spark,role=batch,batch/adhoc,user=spark}": 1,
+		"mesos_slave_framework_executors{framework_id=f1}":                                                   1,
+		"mesos_slave_framework_executors{framework_id=f2}":                                                   1,
+		"mesos_slave_framework_completed_executors{framework_id=f1}":                                         1,
+		"mesos_slave_framework_completed_executors{framework_id=f2}":                                         0,
+		"mesos_slave_framework_completed_tasks{framework_id=f1}":                                             2,
+		"mesos_slave_framework_completed_tasks{framework_id=f2}":                                             0,
+
+		"mesos_slave_executor_info{container=c1,directory=/var/lib/mesos/slaves/a1/frameworks/f1/executors/web.1/runs/c1," +
+			"executor_id=web.1,executor_name=Command Executor,framework_id=f1,source=web.1}": 1,
+		"mesos_slave_executor_info{container=c2,directory=,executor_id=driver,executor_name=,framework_id=f2,source=spark}": 1,
+
+		"mesos_slave_executor_cpus{" + web + "}":                     1.1,
+		"mesos_slave_executor_cpus{" + driver + "}":                  0.5,
+		"mesos_slave_executor_mem_bytes{" + web + "}":                160 * 1024 * 1024,
+		"mesos_slave_executor_mem_bytes{" + driver + "}":             64 * 1024 * 1024,
+		"mesos_slave_executor_disk_bytes{" + web + "}":               0,
+		"mesos_slave_executor_disk_bytes{" + driver + "}":            100 * 1024 * 1024,
+		"mesos_slave_executor_tasks{" + web + ",state=queued}":       0,
+		"mesos_slave_executor_tasks{" + web + ",state=launched}":     1,
+		"mesos_slave_executor_tasks{" + web + ",state=completed}":    1,
+		"mesos_slave_executor_tasks{" + driver + ",state=queued}":    1,
+		"mesos_slave_executor_tasks{" + driver + ",state=launched}":  0,
+		"mesos_slave_executor_tasks{" + driver + ",state=completed}": 0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
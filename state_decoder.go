@@ -0,0 +1,181 @@
+// Streaming decoder for the master's /state, /state-summary, /slaves and
+// /frameworks endpoints.
+//
+// The full /state of a large cluster is hundreds of MB, most of which are
+// tasks and completed frameworks. Instead of unmarshalling the whole
+// response, decodeState walks the top-level object token by token, decodes
+// the requested fields element by element and skips everything else without
+// keeping it in memory.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decodeState decodes the top-level fields of a master state response named
+// in fields into st. Only "slaves" and "frameworks" are supported; of the
+// frameworks, only their ID, name, activity and tasks are decoded. The
+// response may be wrapped in a JSONP callback, as returned for the "jsonp"
+// query parameter.
+func decodeState(r io.Reader, fields []string, st *state) error {
+	br := bufio.NewReader(r)
+	if err := skipJSONPCallback(br); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(br)
+
+	return decodeObject(dec, func(key string) error {
+		if !stringInSlice(key, fields) {
+			return skipValue(dec)
+		}
+		switch key {
+		case "slaves":
+			return decodeArray(dec, func() error {
+				var s slave
+				if err := dec.Decode(&s); err != nil {
+					return err
+				}
+				st.Slaves = append(st.Slaves, s)
+				return nil
+			})
+		case "frameworks":
+			return decodeArray(dec, func() error {
+				var f framework
+				if err := decodeFramework(dec, &f); err != nil {
+					return err
+				}
+				st.Frameworks = append(st.Frameworks, f)
+				return nil
+			})
+		}
+		return skipValue(dec)
+	})
+}
+
+func decodeFramework(dec *json.Decoder, f *framework) error {
+	return decodeObject(dec, func(key string) error {
+		var tasks *[]task
+		switch key {
+		case "id":
+			return dec.Decode(&f.ID)
+		case "name":
+			return dec.Decode(&f.Name)
+		case "active":
+			return dec.Decode(&f.Active)
+		case "tasks":
+			tasks = &f.Tasks
+		case "completed_tasks":
+			tasks = &f.Completed
+		default:
+			return skipValue(dec)
+		}
+		return decodeArray(dec, func() error {
+			var t task
+			if err := dec.Decode(&t); err != nil {
+				return err
+			}
+			*tasks = append(*tasks, t)
+			return nil
+		})
+	})
+}
+
+// decodeObject calls f for every key of the next JSON object, which must
+// consume the value of the key.
+func decodeObject(dec *json.Decoder, f func(key string) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key %v", t)
+		}
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// decodeArray calls f for every element of the next JSON array, which must
+// consume the element. null is treated as an empty array.
+func decodeArray(dec *json.Decoder, f func() error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+	if t != json.Delim('[') {
+		return fmt.Errorf("expected array, got %v", t)
+	}
+	for dec.More() {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// skipValue skips the next JSON value.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %v, got %v", delim, t)
+	}
+	return nil
+}
+
+// skipJSONPCallback skips the "callback(" prefix of a JSONP response. The
+// suffix is never read, as decoding stops at the end of the object.
+func skipJSONPCallback(r *bufio.Reader) error {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == '{' {
+			return nil
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			break
+		}
+		r.ReadByte()
+	}
+	if _, err := r.ReadString('('); err != nil {
+		return fmt.Errorf("invalid JSONP response: %v", err)
+	}
+	return nil
+}
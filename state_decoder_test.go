@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const stateFixture = `{
+  "version": "1.9.0",
+  "slaves": [
+    {"pid": "slave(1)@10.0.0.1:5051", "resources": {"cpus": 4, "mem": 1024, "disk": 2048, "ports": "[31000-32000]"},
+     "used_resources": {"cpus": 1}, "unreserved_resources": {"cpus": 2}, "attributes": {"rack": "r1"}}
+  ],
+  "frameworks": [
+    {"id": "f1", "active": true, "offers": [{"id": "o1"}], "tasks": [{"id": "t1", "state": "TASK_RUNNING"}], "completed_tasks": null}
+  ],
+  "completed_frameworks": [{"id": "f0", "tasks": [[{}]]}]
+}`
+
+func TestDecodeState(t *testing.T) {
+	want := state{
+		Slaves: []slave{{
+			PID:        "slave(1)@10.0.0.1:5051",
+			Total:      resources{CPUs: 4, Mem: 1024, Disk: 2048, Ports: ranges{{31000, 32000}}},
+			Used:       resources{CPUs: 1},
+			Unreserved: resources{CPUs: 2},
+			Attributes: map[string]json.RawMessage{"rack": json.RawMessage(`"r1"`)},
+		}},
+		Frameworks: []framework{{
+			ID:     "f1",
+			Active: true,
+			Tasks:  []task{{ID: "t1", State: "TASK_RUNNING"}},
+		}},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		fields []string
+		want   state
+	}{
+		{"all", stateFixture, []string{"slaves", "frameworks"}, want},
+		{"slaves", stateFixture, []string{"slaves"}, state{Slaves: want.Slaves}},
+		{"jsonp", "cb(" + stateFixture + ");", []string{"slaves"}, state{Slaves: want.Slaves}},
+	} {
+		var got state
+		if err := decodeState(bytes.NewBufferString(tt.body), tt.fields, &got); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	var st state
+	if err := decodeState(bytes.NewBufferString(`{"slaves": {}}`), []string{"slaves"}, &st); err == nil {
+		t.Error("expected error for malformed slaves")
+	}
+}
+
+// syntheticState returns a /state response of a cluster with the given
+// number of agents, each running tasksPerAgent tasks and having as many
+// completed tasks.
+func syntheticState(agents, tasksPerAgent int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"version":"1.9.0","slaves":[`)
+	for i := 0; i < agents; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"id":"agent-%d","pid":"slave(1)@10.0.%d.%d:5051","hostname":"agent-%d",`+
+			`"resources":{"cpus":32,"mem":257000,"disk":900000,"ports":"[31000-32000]"},`+
+			`"used_resources":{"cpus":%d,"mem":%d,"disk":0,"ports":"[31000-31010]"},`+
+			`"unreserved_resources":{"cpus":30,"mem":250000,"disk":900000,"ports":"[31000-32000]"},`+
+			`"attributes":{"rack":"rack-%d","zone":"zone-%d"}}`,
+			i, i/256, i%256, i, tasksPerAgent, tasksPerAgent*512, i%40, i%3)
+	}
+	buf.WriteString(`],"frameworks":[{"id":"marathon","name":"marathon","active":true,"tasks":[`)
+	writeTasks := func(state string) {
+		for i := 0; i < agents*tasksPerAgent; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, `{"id":"app.%d","name":"app","framework_id":"marathon","executor_id":"","slave_id":"agent-%d",`+
+				`"state":"%s","resources":{"cpus":1,"mem":512,"disk":0,"ports":"[31000-31000]"},`+
+				`"statuses":[{"state":"TASK_STARTING","timestamp":1.5e9},{"state":"TASK_RUNNING","timestamp":1.5e9}],`+
+				`"labels":[{"key":"owner","value":"team-%d"}]}`, i, i/tasksPerAgent, state, i%10)
+		}
+	}
+	writeTasks("TASK_RUNNING")
+	buf.WriteString(`],"completed_tasks":[`)
+	writeTasks("TASK_FINISHED")
+	buf.WriteString(`]}],"completed_frameworks":[]}`)
+	return buf.Bytes()
+}
+
+func benchmarkDecodeState(b *testing.B, decode func([]byte) error) {
+	fixture := syntheticState(1000, 20)
+	b.SetBytes(int64(len(fixture)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := decode(fixture); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeState_Unmarshal(b *testing.B) {
+	benchmarkDecodeState(b, func(fixture []byte) error {
+		var st state
+		return json.NewDecoder(bytes.NewReader(fixture)).Decode(&st)
+	})
+}
+
+func BenchmarkDecodeState_Streaming(b *testing.B) {
+	benchmarkDecodeState(b, func(fixture []byte) error {
+		var st state
+		return decodeState(bytes.NewReader(fixture), []string{"slaves"}, &st)
+	})
+}
+
+func BenchmarkDecodeState_StreamingSlavesEndpoint(b *testing.B) {
+	// /slaves only contains the agents, which is what the master state
+	// collector needs.
+	fixture := syntheticState(1000, 20)
+	end := bytes.Index(fixture, []byte(`],"frameworks"`))
+	slaves := append(append([]byte(`{`), fixture[len(`{"version":"1.9.0",`):end+1]...), '}')
+
+	b.SetBytes(int64(len(slaves)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var st state
+		if err := decodeState(bytes.NewReader(slaves), []string{"slaves"}, &st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
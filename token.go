@@ -0,0 +1,268 @@
+// Authentication tokens obtained by logging in, either in DC/OS strict mode
+// with a JWT signed by the service account's private key, or with OAuth2
+// client credentials. A token manager shares a token between all clients,
+// refreshes it before it expires, and backs off after failed logins.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// loginTokenLifetime is the lifetime of the signed login JWT, also
+	// assumed for tokens whose expiry cannot be read.
+	loginTokenLifetime = time.Hour
+	// tokenRefreshBefore is how long before their expiry tokens are
+	// refreshed, at most half of their lifetime.
+	tokenRefreshBefore = 5 * time.Minute
+	loginBackoffMin    = time.Second
+	loginBackoffMax    = 5 * time.Minute
+)
+
+var (
+	authTokenExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mesos",
+		Subsystem: "exporter",
+		Name:      "auth_token_expiry_timestamp_seconds",
+		Help:      "Expiry of the current strict mode or OAuth2 authentication token.",
+	})
+	authLogins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "mesos",
+		Subsystem: "exporter",
+		Name:      "auth_logins_total",
+		Help:      "Total number of strict mode or OAuth2 login attempts.",
+	})
+	authLoginErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mesos",
+		Subsystem: "exporter",
+		Name:      "auth_login_errors_total",
+		Help:      "Total number of failed strict mode or OAuth2 logins by reason: sign, request, status or response.",
+	}, []string{"reason"})
+)
+
+// loginError is an error of a login with the reason counted.
+type loginError struct {
+	reason string
+	err    error
+}
+
+func (e *loginError) Error() string { return e.err.Error() }
+
+// tokenManager obtains and refreshes the token of a login, and authenticates
+// requests with it.
+type tokenManager struct {
+	url string
+	// header formats the token as Authorization header.
+	header string
+	// login returns a new token and its expiry.
+	login func() (string, time.Time, error)
+	now   func() time.Time
+
+	// logins is a semaphore serializing the logins, while mu guards the
+	// token, so that the current token can be used while it is refreshed.
+	logins chan struct{}
+	mu     sync.Mutex
+	token  string
+	// expiry is when the token expires, and refresh when it is refreshed.
+	expiry, refresh time.Time
+	// failures are the consecutive failed logins, the last one with err,
+	// after which no login is attempted before retry.
+	failures int
+	err      error
+	retry    time.Time
+}
+
+func newTokenManager(url, header string, login func() (string, time.Time, error)) *tokenManager {
+	return &tokenManager{url: url, header: header, login: login, now: time.Now, logins: make(chan struct{}, 1)}
+}
+
+func (m *tokenManager) authenticate(req *http.Request) error {
+	token, err := m.get()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(m.header, token))
+	return nil
+}
+
+// get returns a valid token, logging in if there is none or it is due to be
+// refreshed. While another caller refreshes a valid token, it is returned
+// without waiting.
+func (m *tokenManager) get() (string, error) {
+	token, valid, fresh := m.current()
+	if fresh {
+		return token, nil
+	}
+	if valid {
+		select {
+		case m.logins <- struct{}{}:
+		default:
+			return token, nil
+		}
+	} else {
+		m.logins <- struct{}{}
+	}
+	defer func() { <-m.logins }()
+
+	// The token may have been refreshed while waiting.
+	if token, valid, fresh = m.current(); fresh {
+		return token, nil
+	}
+	m.mu.Lock()
+	backingOff, err := m.now().Before(m.retry), m.err
+	m.mu.Unlock()
+	if backingOff {
+		if valid {
+			return token, nil
+		}
+		return "", fmt.Errorf("not logging in before backoff after error: %v", err)
+	}
+
+	authLogins.Inc()
+	newToken, expiry, err := m.login()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if err != nil {
+		reason := "request"
+		if e, ok := err.(*loginError); ok {
+			reason = e.reason
+		}
+		authLoginErrors.WithLabelValues(reason).Inc()
+
+		m.failures++
+		backoff := loginBackoffMax
+		if m.failures <= 10 {
+			if b := loginBackoffMin << uint(m.failures-1); b < backoff {
+				backoff = b
+			}
+		}
+		m.err, m.retry = err, now.Add(backoff)
+		log.WithFields(log.Fields{
+			"url":     m.url,
+			"error":   err,
+			"backoff": backoff,
+		}).Error("Error logging in")
+		errorCounter.Inc()
+		if valid {
+			return token, nil
+		}
+		return "", err
+	}
+
+	refreshBefore := expiry.Sub(now) / 2
+	if refreshBefore > tokenRefreshBefore {
+		refreshBefore = tokenRefreshBefore
+	}
+	m.token, m.expiry, m.refresh = newToken, expiry, expiry.Add(-refreshBefore)
+	m.failures, m.err, m.retry = 0, nil, time.Time{}
+	authTokenExpiry.Set(float64(expiry.Unix()))
+	log.WithFields(log.Fields{
+		"url":     m.url,
+		"expires": expiry,
+	}).Debug("logged in")
+	return m.token, nil
+}
+
+// current returns the current token, whether it is valid, and whether it is
+// not yet due to be refreshed.
+func (m *tokenManager) current() (token string, valid, fresh bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	valid = m.token != "" && now.Before(m.expiry)
+	return m.token, valid, valid && now.Before(m.refresh)
+}
+
+// strictLogin returns a login with a JWT signed by the private key of the
+// service account uid.
+func strictLogin(client *http.Client, loginURL, uid string, signingKey func() []byte) func() (string, time.Time, error) {
+	return func() (string, time.Time, error) {
+		signKey, err := jwt.ParseRSAPrivateKeyFromPEM(signingKey())
+		if err != nil {
+			return "", time.Time{}, &loginError{"sign", fmt.Errorf("error parsing private key: %v", err)}
+		}
+		expires := time.Now().Add(loginTokenLifetime)
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"uid": uid,
+			"exp": expires.Unix(),
+		}).SignedString(signKey)
+		if err != nil {
+			return "", time.Time{}, &loginError{"sign", fmt.Errorf("error creating login token: %v", err)}
+		}
+
+		body, err := json.Marshal(&tokenRequest{UID: uid, Token: signed})
+		if err != nil {
+			return "", time.Time{}, &loginError{"request", err}
+		}
+		req, err := http.NewRequest("POST", loginURL, bytes.NewReader(body))
+		if err != nil {
+			return "", time.Time{}, &loginError{"request", err}
+		}
+		req.Header.Add("Content-Type", "application/json")
+		var token tokenResponse
+		if err := doLogin(client, req, &token); err != nil {
+			return "", time.Time{}, err
+		}
+		if token.Token == "" {
+			return "", time.Time{}, &loginError{"response", errors.New("no token in response")}
+		}
+
+		expiry, ok := tokenExpiry(token.Token)
+		if !ok {
+			expiry = expires
+		}
+		return token.Token, expiry, nil
+	}
+}
+
+// doLogin sends a login request and decodes the response into target.
+func doLogin(client *http.Client, req *http.Request, target interface{}) error {
+	req.Header.Add("User-Agent", userAgent())
+	res, err := client.Do(req)
+	if err != nil {
+		return &loginError{"request", err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return &loginError{"status", fmt.Errorf("unexpected status: %s: %s", res.Status, bytes.TrimSpace(msg))}
+	}
+	if err := json.NewDecoder(res.Body).Decode(target); err != nil {
+		return &loginError{"response", fmt.Errorf("error decoding response body: %v", err)}
+	}
+	return nil
+}
+
+// tokenExpiry reads the expiry of a token from its exp claim, if it is a JWT.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(claims.Exp), 0), true
+}
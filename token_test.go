@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeIAM is a strict mode login endpoint, which verifies the login token
+// and issues tokens valid for lifetime.
+type fakeIAM struct {
+	key      *rsa.PrivateKey
+	lifetime time.Duration
+	now      func() time.Time
+	fail     int32
+	logins   int32
+}
+
+func (iam *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&iam.logins, 1)
+	if atomic.LoadInt32(&iam.fail) != 0 {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := jwt.Parse(req.Token, func(*jwt.Token) (interface{}, error) { return &iam.key.PublicKey, nil }); err != nil || req.UID != "exporter" {
+		http.Error(w, fmt.Sprintf("invalid login token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid": req.UID,
+		"exp": iam.now().Add(iam.lifetime).Unix(),
+		"n":   atomic.LoadInt32(&iam.logins),
+	}).SignedString([]byte("iam"))
+	json.NewEncoder(w).Encode(&tokenResponse{Token: token})
+}
+
+func newFakeIAM(t *testing.T, now func() time.Time) (*fakeIAM, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return &fakeIAM{key: key, lifetime: time.Hour, now: now}, pemKey
+}
+
+func TestTokenManager(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	iam, key := newFakeIAM(t, clock)
+	srv := httptest.NewServer(iam)
+	defer srv.Close()
+	m := newTokenManager(srv.URL, "token=%s", strictLogin(http.DefaultClient, srv.URL, "exporter", func() []byte { return key }))
+	m.now = clock
+
+	// Concurrent collectors share a single login.
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = m.get()
+		}(i)
+	}
+	wg.Wait()
+	if iam.logins != 1 {
+		t.Errorf("got %d logins, want 1", iam.logins)
+	}
+	for _, token := range tokens {
+		if token == "" || token != tokens[0] {
+			t.Fatalf("got tokens %q, want one valid token", tokens)
+		}
+	}
+	var expiry dto.Metric
+	authTokenExpiry.Write(&expiry)
+	if want := float64(clock().Add(time.Hour).Unix()); expiry.GetGauge().GetValue() != want {
+		t.Errorf("got token expiry %v, want %v", expiry.GetGauge().GetValue(), want)
+	}
+
+	// The token is refreshed before it expires.
+	advance(54 * time.Minute)
+	if token, err := m.get(); err != nil || token != tokens[0] || iam.logins != 1 {
+		t.Errorf("token refreshed too early: %v, %d logins", err, iam.logins)
+	}
+	advance(2 * time.Minute)
+	refreshed, err := m.get()
+	if err != nil || refreshed == tokens[0] || iam.logins != 2 {
+		t.Errorf("token not refreshed before expiry: %v, %d logins", err, iam.logins)
+	}
+
+	// Failed refreshes keep the valid token and back off.
+	statusErrors := func() float64 {
+		var m dto.Metric
+		authLoginErrors.WithLabelValues("status").Write(&m)
+		return m.GetCounter().GetValue()
+	}
+	before := statusErrors()
+	atomic.StoreInt32(&iam.fail, 1)
+	advance(56 * time.Minute)
+	if token, err := m.get(); err != nil || token != refreshed {
+		t.Errorf("got token %q, error %v, want the valid token", token, err)
+	}
+	if token, err := m.get(); err != nil || token != refreshed || iam.logins != 3 {
+		t.Errorf("got token %q, error %v, %d logins while backing off", token, err, iam.logins)
+	}
+	if got := statusErrors() - before; got != 1 {
+		t.Errorf("got %v login errors, want 1", got)
+	}
+
+	// Without a valid token, no token is returned.
+	advance(5 * time.Minute)
+	if token, err := m.get(); err == nil || token != "" {
+		t.Errorf("got token %q, error %v after expiry, want error", token, err)
+	}
+	if _, err := m.get(); err == nil || iam.logins != 4 {
+		t.Errorf("got error %v, %d logins while backing off, want error and 4 logins", err, iam.logins)
+	}
+	atomic.StoreInt32(&iam.fail, 0)
+	advance(2 * time.Second)
+	if token, err := m.get(); err != nil || token == "" || iam.logins != 5 {
+		t.Errorf("got token %q, error %v, %d logins after backoff", token, err, iam.logins)
+	}
+}
+
+func TestStrictModeRequests(t *testing.T) {
+	iam, key := newFakeIAM(t, time.Now)
+	login := httptest.NewServer(iam)
+	defer login.Close()
+
+	var requests int32
+	var authorization atomic.Value
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Write([]byte("{}"))
+	}))
+	defer target.Close()
+
+	newAuth := func() authProvider {
+		return newTokenManager(login.URL, "token=%s", strictLogin(http.DefaultClient, login.URL, "exporter", func() []byte { return key }))
+	}
+	client := &httpClient{url: target.URL, auth: newAuth()}
+	var v map[string]interface{}
+	if !client.fetchAndDecode("/metrics/snapshot", &v) {
+		t.Fatal("request failed")
+	}
+	if got, _ := authorization.Load().(string); len(got) < len("token=x") || got[:6] != "token=" {
+		t.Errorf("got Authorization %q, want a token", got)
+	}
+
+	// Requests are not sent without a token.
+	atomic.StoreInt32(&iam.fail, 1)
+	client.auth = newAuth()
+	if client.fetchAndDecode("/metrics/snapshot", &v) {
+		t.Error("request succeeded without a token")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
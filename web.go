@@ -0,0 +1,308 @@
+// TLS and basic authentication of the exporter's own listener, configured by
+// a web configuration file in the format of the Prometheus exporter toolkit:
+//
+//	tls_server_config:
+//	  cert_file: /etc/mesos_exporter/server.pem
+//	  key_file: /etc/mesos_exporter/server-key.pem
+//	  client_auth_type: RequireAndVerifyClientCert
+//	  client_ca_file: /etc/mesos_exporter/clients-ca.pem
+//	  min_version: TLS12
+//	basic_auth_users:
+//	  prometheus: $2y$10$...
+//
+// TLS is enabled if the file has a certificate when the exporter starts. The
+// file is read again for every TLS handshake and authenticated request, so
+// that certificates, client CAs and users are reloaded without restarting. A
+// file that cannot be read or is invalid is ignored, keeping the last valid
+// configuration.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	webConfig struct {
+		TLSServerConfig tlsServerConfig   `yaml:"tls_server_config"`
+		BasicAuthUsers  map[string]string `yaml:"basic_auth_users"`
+	}
+
+	tlsServerConfig struct {
+		CertFile       string     `yaml:"cert_file"`
+		KeyFile        string     `yaml:"key_file"`
+		ClientAuthType string     `yaml:"client_auth_type"`
+		ClientCAFile   string     `yaml:"client_ca_file"`
+		MinVersion     tlsVersion `yaml:"min_version"`
+		MaxVersion     tlsVersion `yaml:"max_version"`
+	}
+
+	tlsVersion uint16
+)
+
+var (
+	tlsVersions = map[string]tlsVersion{
+		"TLS10": tls.VersionTLS10,
+		"TLS11": tls.VersionTLS11,
+		"TLS12": tls.VersionTLS12,
+	}
+
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"":                           tls.NoClientCert,
+		"NoClientCert":               tls.NoClientCert,
+		"RequestClientCert":          tls.RequestClientCert,
+		"RequireAnyClientCert":       tls.RequireAnyClientCert,
+		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+	}
+)
+
+func (v *tlsVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	version, ok := tlsVersions[s]
+	if !ok {
+		return fmt.Errorf("unknown TLS version %q", s)
+	}
+	*v = version
+	return nil
+}
+
+// loadWebConfig reads and validates a web configuration file.
+func loadWebConfig(path string) (*webConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseWebConfig(path, content)
+}
+
+// parseWebConfig parses and validates the content of a web configuration file.
+func parseWebConfig(path string, content []byte) (*webConfig, error) {
+	cfg := &webConfig{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing web configuration %s: %v", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid web configuration %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *webConfig) validate() error {
+	c := cfg.TLSServerConfig
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("must supply both cert_file and key_file")
+	}
+	clientAuth, ok := clientAuthTypes[c.ClientAuthType]
+	if !ok {
+		return fmt.Errorf("unknown client_auth_type %q", c.ClientAuthType)
+	}
+	if c.CertFile == "" && (c.ClientAuthType != "" || c.ClientCAFile != "") {
+		return errors.New("client authentication requires cert_file and key_file")
+	}
+	if c.ClientCAFile != "" && clientAuth != tls.VerifyClientCertIfGiven && clientAuth != tls.RequireAndVerifyClientCert {
+		return errors.New("client_ca_file requires client_auth_type VerifyClientCertIfGiven or RequireAndVerifyClientCert")
+	}
+	if c.ClientCAFile == "" && (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) {
+		return fmt.Errorf("client_auth_type %s requires client_ca_file", c.ClientAuthType)
+	}
+	if c.MaxVersion != 0 && c.MinVersion > c.MaxVersion {
+		return errors.New("min_version must not be greater than max_version")
+	}
+	for user, hash := range cfg.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid bcrypt hash of user %q: %v", user, err)
+		}
+	}
+	return nil
+}
+
+// tlsConfig loads the certificates of the configuration.
+func (cfg *webConfig) tlsConfig() (*tls.Config, error) {
+	c := cfg.TLSServerConfig
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading server certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuthTypes[c.ClientAuthType],
+		MinVersion:   uint16(c.MinVersion),
+		MaxVersion:   uint16(c.MaxVersion),
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	if c.ClientCAFile != "" {
+		if tlsConfig.ClientCAs, err = getX509CertPool([]string{c.ClientCAFile}); err != nil {
+			return nil, err
+		}
+	}
+	return tlsConfig, nil
+}
+
+// webServer serves a handler as configured by a web configuration file, or
+// without TLS and authentication if there is none.
+type webServer struct {
+	// configFile is the web configuration file, nil if there is none.
+	configFile *watchedFiles
+	handler    http.Handler
+
+	mu sync.Mutex
+	// authenticated caches the successful bcrypt comparisons, as they are
+	// deliberately slow.
+	authenticated map[[sha256.Size]byte]bool
+}
+
+// unauthenticatedPaths are served without basic authentication, so that
+// health checks of e.g. Kubernetes or Marathon need no credentials.
+var unauthenticatedPaths = map[string]bool{
+	"/-/healthy": true,
+	"/-/ready":   true,
+}
+
+// dummyHash is compared with the passwords of unknown users, so that they
+// take as long to reject as wrong passwords.
+var dummyHash = []byte("$2a$10$s/7EjVOJEUi2GzYBbPol0eB0xJkaZp8gnEypmj.ZEDRPljtPhvv6i")
+
+// newWebServer returns the server of the handler, failing if the web
+// configuration file cannot be loaded.
+func newWebServer(configFile string, handler http.Handler) (*webServer, error) {
+	s := &webServer{handler: handler, authenticated: map[[sha256.Size]byte]bool{}}
+	if configFile != "" {
+		var err error
+		s.configFile, err = newWatchedFiles([]string{configFile}, func(contents [][]byte) (interface{}, error) {
+			return parseWebConfig(configFile, contents[0])
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// config returns the current web configuration, or the last valid one.
+func (s *webServer) config() *webConfig {
+	if s.configFile == nil {
+		return &webConfig{}
+	}
+	return s.configFile.get().(*webConfig)
+}
+
+func (s *webServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if unauthenticatedPaths[r.URL.Path] {
+		s.handler.ServeHTTP(w, r)
+		return
+	}
+	if cfg := s.config(); len(cfg.BasicAuthUsers) > 0 {
+		user, password, ok := r.BasicAuth()
+		if !ok || !s.authenticate(cfg, user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mesos_exporter"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s *webServer) authenticate(cfg *webConfig, user, password string) bool {
+	hash, known := cfg.BasicAuthUsers[user]
+	if !known {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + password))
+
+	s.mu.Lock()
+	cached := s.authenticated[key]
+	s.mu.Unlock()
+	if cached {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The cache only grows with changes of users and passwords, but is
+	// bounded anyway.
+	if len(s.authenticated) >= 100 {
+		s.authenticated = map[[sha256.Size]byte]bool{}
+	}
+	s.authenticated[key] = true
+	return true
+}
+
+// getConfigForClient loads the TLS configuration for every handshake.
+func (s *webServer) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	cfg := s.config()
+	if cfg.TLSServerConfig.CertFile == "" {
+		err := errors.New("no server certificate")
+		log.WithField("error", err).Error("Error loading web TLS configuration")
+		return nil, err
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		log.WithField("error", err).Error("Error loading web TLS configuration")
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+// getCertificate loads the server certificate for every handshake. It is
+// only used if the configuration returned by getConfigForClient has none, but
+// the ServeTLS of older Go versions needs it to start without certificate
+// files.
+func (s *webServer) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	tlsConfig, err := s.getConfigForClient(hello)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsConfig.Certificates[0], nil
+}
+
+// serve serves on the listener, with TLS if the web configuration has a
+// server certificate.
+func (s *webServer) serve(l net.Listener) error {
+	cfg := s.config()
+	server := &http.Server{Handler: s}
+	if cfg.TLSServerConfig.CertFile == "" {
+		return server.Serve(l)
+	}
+	if _, err := cfg.tlsConfig(); err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{
+		GetCertificate:     s.getCertificate,
+		GetConfigForClient: s.getConfigForClient,
+	}
+	return server.ServeTLS(l, "", "")
+}
+
+// listenAndServe serves the handler on addr as configured by the web
+// configuration file, if any.
+func listenAndServe(addr, webConfigFile string, handler http.Handler) error {
+	s, err := newWebServer(webConfigFile, handler)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(l)
+}
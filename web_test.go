@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCert writes a self-signed certificate with the serial number and its
+// key to dir, returning their paths.
+func writeCert(t *testing.T, dir string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		// The certificate is its own CA, so that it can be trusted.
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestLoadWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for content, want := range map[string]string{
+		"tls_server_config: {cert_file: a.pem}":                                                                "both cert_file and key_file",
+		"tls_server_config: {cert_file: a.pem, key_file: b.pem, client_auth_type: Maybe}":                      "unknown client_auth_type",
+		"tls_server_config: {client_ca_file: ca.pem}":                                                          "requires cert_file",
+		"tls_server_config: {cert_file: a.pem, key_file: b.pem, client_auth_type: RequireAndVerifyClientCert}": "requires client_ca_file",
+		"tls_server_config: {cert_file: a.pem, key_file: b.pem, min_version: SSL3}":                            "unknown TLS version",
+		"basic_auth_users: {prometheus: secret}":                                                               "invalid bcrypt hash",
+		"basic_auth: {}":                                                                                       "not found",
+	} {
+		if _, err := loadWebConfig(writeConfig(t, dir, content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("web config %q: got error %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestWebServerBasicAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeConfig(t, dir, "basic_auth_users: {prometheus: "+string(hash)+"}")
+	s, err := newWebServer(file, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	check := func() {
+		for _, tt := range []struct {
+			path, user, password string
+			want                 int
+		}{
+			{"/", "", "", http.StatusUnauthorized},
+			{"/", "prometheus", "wrong", http.StatusUnauthorized},
+			{"/", "grafana", "secret", http.StatusUnauthorized},
+			{"/", "prometheus", "secret", http.StatusOK},
+			{"/", "prometheus", "secret", http.StatusOK},
+			{"/-/reload", "", "", http.StatusUnauthorized},
+			{"/-/healthy", "", "", http.StatusOK},
+			{"/-/ready", "", "", http.StatusOK},
+		} {
+			req, _ := http.NewRequest("GET", srv.URL+tt.path, nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("%s %s:%s: got status %d, want %d", tt.path, tt.user, tt.password, res.StatusCode, tt.want)
+			}
+		}
+	}
+	check()
+
+	// An invalid or missing file keeps the last valid configuration.
+	writeConfig(t, dir, "basic_auth_users: {prometheus: secret}")
+	check()
+	os.Remove(file)
+	check()
+}
+
+func TestWebServerTLSReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesos_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, 1)
+	file := writeConfig(t, dir, "tls_server_config: {cert_file: "+certFile+", key_file: "+keyFile+"}")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := newWebServer(file, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.serve(l)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}}
+	serial := func() int64 {
+		res, err := client.Get("https://" + l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if got := serial(); got != 1 {
+		t.Errorf("got certificate %d, want 1", got)
+	}
+	writeCert(t, dir, 2)
+	if got := serial(); got != 2 {
+		t.Errorf("got certificate %d after reload, want 2", got)
+	}
+}